@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/berquerant/cmdcomp/pkg/cache"
+)
+
+// runCache handles 'cache list', 'cache show HASH' and 'cache prune [DURATION]'.
+func runCache(w io.Writer, dir string, args []string) error {
+	if dir == "" {
+		d, err := cache.DefaultDir()
+		if err != nil {
+			return err
+		}
+		dir = d
+	}
+	c := cache.New(dir)
+
+	if len(args) == 0 {
+		return fmt.Errorf("%w: cache requires list, show or prune", cache.ErrCache)
+	}
+	switch args[0] {
+	case "list":
+		if err := checkArgs("cache list", args, 1); err != nil {
+			return err
+		}
+		es, err := c.List()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "HASH\tCREATED\tSIZE\tARGS")
+		for _, e := range es {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n",
+				e.Hash, e.Created.Format(time.RFC3339), e.Size, strings.Join(e.Key.Args, " "))
+		}
+		return tw.Flush()
+	case "show":
+		if len(args) < 2 {
+			return fmt.Errorf("%w: cache show requires HASH", cache.ErrCache)
+		}
+		if err := checkArgs("cache show", args, 2); err != nil {
+			return err
+		}
+		e, err := c.Inspect(args[1])
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(e, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(w, string(b))
+		return nil
+	case "prune":
+		if err := checkArgs("cache prune", args, 2); err != nil {
+			return err
+		}
+		before := time.Now()
+		if len(args) > 1 {
+			d, err := time.ParseDuration(args[1])
+			if err != nil {
+				return fmt.Errorf("%w: invalid duration: %w", cache.ErrCache, err)
+			}
+			before = before.Add(-d)
+		}
+		removed, err := c.Prune(before)
+		for _, e := range removed {
+			_, _ = fmt.Fprintln(w, e.Hash)
+		}
+		return err
+	default:
+		return fmt.Errorf("%w: unknown cache command %s", cache.ErrCache, args[0])
+	}
+}
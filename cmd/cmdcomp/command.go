@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/defaults"
+	"github.com/berquerant/cmdcomp/pkg/run"
+	"github.com/berquerant/cmdcomp/version"
+	"github.com/spf13/pflag"
+)
+
+// app is the state shared by the commands.
+type app struct {
+	globals *globalFlags
+	flags   *runFlags
+	origins defaults.Origins
+	files   []*defaults.Source
+	// args are the positional args of the command before the first "--".
+	args []string
+	// before are the args parsed as the flags, after are the args after the first "--".
+	before, after []string
+	w             io.Writer
+}
+
+// command is a subcommand of cmdcomp, the first positional arg before the first "--".
+//
+// The flags can be given before or after the command name, like 'cmdcomp --cacheDir DIR cache list'.
+// The args after the first "--" are passed to the commands as they are.
+type command struct {
+	name string
+	// runFlags is true if the command takes the flags of run, otherwise only the global flags.
+	runFlags bool
+	run      func(a *app) error
+}
+
+// flagSet returns the flag set of the command.
+func (c *command) flagSet(g *globalFlags, f *runFlags) *pflag.FlagSet {
+	if c.runFlags {
+		return f.fs
+	}
+	return g.newFlagSet(c.name)
+}
+
+var errCommand = errors.New("Command")
+
+// checkArgs returns an error if the command has more than n positional args.
+func checkArgs(name string, args []string, n int) error {
+	if len(args) > n {
+		return fmt.Errorf("%w: %s: unexpected args %q", errCommand, name, args[n:])
+	}
+	return nil
+}
+
+var commands = []*command{
+	{
+		name:     "run",
+		runFlags: true,
+		run:      runRun,
+	},
+	{
+		name: "cache",
+		run: func(a *app) error {
+			return runCache(a.w, *a.globals.cacheDir, a.args)
+		},
+	},
+	{
+		name:     "config",
+		runFlags: true,
+		run: func(a *app) error {
+			return runConfig(a.w, a.flags.fs, a.origins, a.files, a.args)
+		},
+	},
+	{
+		name: "completion",
+		run: func(a *app) error {
+			return runCompletion(a.w, a.args)
+		},
+	},
+	{
+		name: "version",
+		run: func(a *app) error {
+			if err := checkArgs("version", a.args, 0); err != nil {
+				return err
+			}
+			version.Write(a.w)
+			return nil
+		},
+	},
+}
+
+func findCommand(name string) *command {
+	i := slices.IndexFunc(commands, func(c *command) bool {
+		return c.name == name
+	})
+	if i < 0 {
+		return nil
+	}
+	return commands[i]
+}
+
+// selectCommand returns the command named by the first positional arg before the first "--".
+// Returns run if no command is named, so that 'cmdcomp [flags] -- ...' runs the comparison.
+func selectCommand(before []string) (*command, error) {
+	// the flags of run contain the flags of all the commands, so the positional args can be found regardless of the command
+	fs := newRunFlags(newGlobalFlags()).fs
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	if err := fs.Parse(before); err != nil && !errors.Is(err, pflag.ErrHelp) {
+		// the flag set of the command reports the error
+		return findCommand("run"), nil
+	}
+	// fs.Arg(0) is the program name
+	args := fs.Args()[1:]
+	if len(args) == 0 {
+		return findCommand("run"), nil
+	}
+	if c := findCommand(args[0]); c != nil {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: unknown command %q", errCommand, args[0])
+}
+
+// exitStatus is the exit status of run.
+type exitStatus struct {
+	status int
+}
+
+func (e *exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", e.status)
+}
+
+// runRun compares the outputs of the commands after the first "--".
+func runRun(a *app) error {
+	if err := checkArgs("run", a.args, 0); err != nil {
+		return err
+	}
+	c := a.flags.newConfig(a.origins)
+	c.SetupLogger(os.Stderr)
+	slog.Debug("parse args", slog.Any("args", a.before))
+	slog.Debug("init args", slog.Any("args", a.after))
+	if err := c.Init(a.after); err != nil {
+		return err
+	}
+
+	cj, _ := json.Marshal(c)
+	slog.Debug("config", slog.String("json", string(cj)))
+	err := run.Main(c)
+	code := run.ExitCode(err, c.FailOn)
+	if err != nil && run.ExitCode(err, config.FailOnDiff) > run.ExitDiffFound {
+		slog.Error("exit", slog.Any("err", err), slog.Int("status", code))
+	}
+	return &exitStatus{status: code}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/berquerant/cmdcomp/pkg/complete"
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/defaults"
+	"github.com/spf13/pflag"
+)
+
+// runCompletion handles 'completion bash|zsh|fish'.
+func runCompletion(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: completion requires a shell", complete.ErrComplete)
+	}
+	if err := checkArgs("completion", args, 1); err != nil {
+		return err
+	}
+	s, err := complete.Script(args[0], "cmdcomp")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, s)
+	return err
+}
+
+// runComplete completes the last word of args for the completion scripts.
+func runComplete(w io.Writer, fs *pflag.FlagSet, files []*defaults.Source, args []string) error {
+	c := complete.Completer{
+		FlagSet:       fs,
+		DelimiterFlag: "delimiter",
+		Subcommands: map[string][]string{
+			"run":        {complete.Delimiter},
+			"cache":      {"list", "show", "prune"},
+			"config":     {"show", "profiles"},
+			"completion": complete.Shells,
+			"version":    nil,
+		},
+		Values: map[string][]string{
+			defaults.ProfileFlag: defaults.AvailableProfiles(files...),
+			"dryRun":             {config.DryRunText, config.DryRunJSON},
+			"brief":              {config.BriefText, config.BriefJSON, config.BriefQuiet},
+			"binary":             {config.BinaryChecksum, config.BinaryHexdump, config.BinaryText},
+			"failOn":             {config.FailOnDiff, config.FailOnError, config.FailOnNever},
+			"sweepAgainst":       {config.SweepAdjacent, config.SweepFirst},
+		},
+	}
+	return c.Complete(args).Write(w)
+}
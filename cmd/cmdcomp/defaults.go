@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/berquerant/cmdcomp/pkg/defaults"
+	"github.com/spf13/pflag"
+)
+
+// applyDefaults sets the flags not given on the command line
+// from the profiles, CMDCOMP_* environment variables, the project file and the user file.
+// The project file is read only if it is trusted by the user file.
+// Returns the origins of the values and the config files.
+func applyDefaults(fs *pflag.FlagSet) (defaults.Origins, []*defaults.Source, error) {
+	var user *defaults.Source
+	if p, err := defaults.UserFile(); err == nil {
+		if user, err = defaults.ReadFile(defaults.OriginUser, p); err != nil {
+			return nil, nil, err
+		}
+	}
+	var files []*defaults.Source
+	if wd, err := os.Getwd(); err == nil {
+		if p := defaults.FindProjectFile(wd); p != "" {
+			if !user.Trusts(p) {
+				slog.Warn("ignore the untrusted project file; add the directory to trustedProjects of the user file to read it",
+					slog.String("path", p),
+				)
+			} else {
+				s, err := defaults.ReadFile(defaults.OriginProject, p)
+				if err != nil {
+					return nil, nil, err
+				}
+				files = append(files, s)
+			}
+		}
+	}
+	files = append(files, user)
+
+	sources := append([]*defaults.Source{defaults.NewEnvSource(fs)}, files...)
+	profile, err := defaults.NewProfileSource(fs, defaults.ProfileNames(fs, sources...), files...)
+	if err != nil {
+		return nil, nil, err
+	}
+	origins, err := defaults.Apply(fs, append([]*defaults.Source{profile}, sources...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return origins, files, nil
+}
+
+// runConfig handles 'config show' and 'config profiles'.
+func runConfig(w io.Writer, fs *pflag.FlagSet, origins defaults.Origins, files []*defaults.Source, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: config requires show or profiles", defaults.ErrDefaults)
+	}
+	if err := checkArgs("config "+args[0], args, 1); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "show":
+		return defaults.Show(w, fs, origins)
+	case "profiles":
+		return defaults.ShowProfiles(w, files...)
+	default:
+		return fmt.Errorf("%w: unknown config command %q", defaults.ErrDefaults, args[0])
+	}
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
+	"time"
 
+	"github.com/berquerant/cmdcomp/pkg/complete"
 	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/defaults"
 	"github.com/berquerant/cmdcomp/pkg/run"
 	"github.com/berquerant/cmdcomp/pkg/slicex"
-	"github.com/berquerant/cmdcomp/version"
 	"github.com/spf13/pflag"
 )
 
@@ -19,7 +19,45 @@ const usage = `cmdcomp -- compare the output of two commands with optional prepr
 
 # Usage
 
-cmdcomp [flags] -- COMMON_ARGS [-- LEFT_ARGS [-- RIGHT_ARGS]]
+cmdcomp [run] [flags] -- COMMON_ARGS [-- LEFT_ARGS [-- RIGHT_ARGS]]
+cmdcomp [--cacheDir DIR] cache list
+cmdcomp [--cacheDir DIR] cache show HASH
+cmdcomp [--cacheDir DIR] cache prune [DURATION]
+cmdcomp [flags] config show
+cmdcomp [flags] config profiles
+cmdcomp completion bash|zsh|fish
+cmdcomp version
+
+The command is the first argument before the first '--' and defaults to run;
+the flags can be given before or after the command, e.g. 'cmdcomp --cacheDir DIR cache list'.
+--cacheDir, --debug and --version are available to all the commands, the other flags only to run and config.
+The arguments after the first '--' are never taken as the command, e.g. 'cmdcomp -- run ...' runs 'run'.
+
+# Completion
+
+source <(cmdcomp completion bash)  # bash, requires bash-completion to complete the wrapped command
+source <(cmdcomp completion zsh)   # zsh
+cmdcomp completion fish | source   # fish
+
+The flags, their values like profile names and the subcommands are completed,
+and the args after the first '--' are completed as the wrapped command, e.g. 'cmdcomp -- helm templ<TAB>'.
+
+# Defaults
+
+Each flag not given on the command line is read from, in order of precedence:
+
+1. the profiles given by --profile
+2. the environment variable CMDCOMP_FLAG_NAME, e.g. CMDCOMP_DIFF for --diff and CMDCOMP_LABEL_FORMAT for --labelFormat;
+   the values of the repeatable flags like --preprocess are separated by newlines
+3. the project file .cmdcomp.json in the current directory or the nearest parent,
+   only if its directory is listed in "trustedProjects" of the user file, since the project file can run commands
+4. the user file $XDG_CONFIG_HOME/cmdcomp/config.json (~/.config/cmdcomp/config.json)
+5. the built-in default
+
+The files are JSON objects whose keys are the flag names, e.g. {"diff": "diff -u --color", "shell": "zsh", "preprocess": ["gron"]}.
+The key "profiles" defines the profiles, e.g. {"profiles": {"secrets": {"preprocess": ["yq 'select(.kind==\"Secret\")'"]}}}.
+The key "trustedProjects" of the user file lists the absolute directories of the project files to be read, e.g. {"trustedProjects": ["/home/me/repo"]}.
+'config show' prints the effective values of the flags and their origins, 'config profiles' prints the available profiles.
 
 # Examples
 
@@ -38,6 +76,16 @@ cmdcomp -x 'diff -u' -- echo -- a -- b
 // diff -u leftfile rightfile --label echo___a --label echo___b
 cmdcomp -x 'diff -u' -l -- echo -- a -- b
 
+// echo a > leftfile
+// echo 'b c' > rightfile
+// diff -u leftfile rightfile --label 'echo a' --label "echo 'b c'"
+cmdcomp --diffExec -x 'diff -u' -l -- echo -- a -- 'b c'
+
+// echo a > leftfile
+// echo b > rightfile
+// diff -u leftfile rightfile --label 'left: echo a' --label 'right: echo b'
+cmdcomp -x 'diff -u' --labelFormat '{{.Side}}: {{.Args | shellquote}}' -- echo -- a -- b
+
 // echo a | sed 's|a|c|' > leftfile
 // echo b | sed 's|a|c|' > rightfile
 // diff leftfile rightfile
@@ -64,6 +112,13 @@ cmdcomp -p "yq 'select(.kind==\"Deployment\" and .metadata.name==\"release-name-
 // objdiff -c leftfile rightfile
 cmdcomp -i 'git checkout datadog-3.69.3' -x 'objdiff -c' -- helm template ./charts/datadog
 
+// helm template ./charts/datadog > leftfile
+// git checkout datadog-3.69.3
+// helm template ./charts/datadog > rightfile
+// git checkout - (even on failure or interrupt)
+// objdiff -c leftfile rightfile
+cmdcomp -i 'git checkout datadog-3.69.3' --undo 'git checkout -' -x 'objdiff -c' -- helm template ./charts/datadog
+
 // echo echo -- a > leftfile
 // echo echo -- b > rightfile
 // diff leftfile rightfile
@@ -74,37 +129,220 @@ cmdcomp -d '---' -- echo --- echo -- a --- echo -- b
 // diff leftfile rightfile
 cmdcomp -d '---' -- cmdcomp --success -- echo -- a -- --- b --- c
 
+// helm template datadog/datadog --version 3.68.0 --set datadog.logLevel=debug > leftfile
+// helm template datadog/datadog --version 3.69.3 --set datadog.logLevel=debug > rightfile
+// diff leftfile rightfile
+cmdcomp --var v=3.68.0,3.69.3 -- helm template datadog/datadog --version '{{.Vars.v}}' --set datadog.logLevel=debug
+
+// echo left > leftfile
+// echo right > rightfile
+// diff leftfile rightfile
+cmdcomp -t -- echo '{{.Side}}'
+
+// helm template datadog/datadog --version 3.60.0 > file1
+// helm template datadog/datadog --version 3.61.0 > file2
+// helm template datadog/datadog --version 3.62.0 > file3
+// diff file1 file2
+// diff file2 file3
+cmdcomp --sweep v --sweepValues 3.60.0,3.61.0,3.62.0 -- helm template datadog/datadog --version '{{.Vars.v}}'
+
+// reuse the output of the left command from the second time on
+cmdcomp --cache -- helm template datadog/datadog -- --version 3.68.0 -- --version 3.69.3
+
+// run helm template 10 times for each version and compare the performance
+cmdcomp --bench 10 --benchOnly -- helm template datadog/datadog -- --version 3.68.0 -- --version 3.69.3
+
 // helm show values datadog/datadog --version 3.69.3 | yq -o json | gron > leftfile
 // helm show values datadog/datadog --version 3.164.1 | yq -o json | gron > rightfile
 // diff -u --color leftfile rightfile
 cmdcomp -x 'diff -u --color' -p 'yq -o json' -p 'gron' -- helm show values datadog/datadog --version -- 3.69.3 -- 3.164.1
 
+// same as above with the built-in profiles
+cmdcomp --profile unified --profile yaml-gron -- helm show values datadog/datadog --version -- 3.69.3 -- 3.164.1
+
+// echo a | sort > left1; echo a | sort -r > left2
+// echo b > rightfile
+// diff left1 rightfile; diff left2 rightfile
+// graph.json: {"stages": [
+//   {"name": "left", "kind": "source", "side": "left"},
+//   {"name": "right", "kind": "source", "side": "right"},
+//   {"name": "sorted", "kind": "transform", "inputs": ["left"], "commands": ["sort"]},
+//   {"name": "reversed", "kind": "transform", "inputs": ["left"], "commands": ["sort -r"]},
+//   {"name": "diff sorted", "kind": "differ", "inputs": ["sorted", "right"]},
+//   {"name": "diff reversed", "kind": "differ", "inputs": ["reversed", "right"]}]}
+cmdcomp --graph graph.json -- echo -- a -- b
+
+# Exit status
+
+0: no diff
+1: diff found
+2: diff command failed
+3: left or right command failed
+4: preprocess failed
+5: timeout or deadline exceeded
+6: other errors, e.g. invalid flags, interceptor, hook or undo failed
+
+--failOn=error (--success) turns 1 into 0, --failOn=never turns all into 0; --failOn wins over --success.
+
 # Flags
 
 `
 
 func main() {
-	fs := pflag.NewFlagSet("main", pflag.ContinueOnError)
+	g := newGlobalFlags()
+	f := newRunFlags(g)
+	// os.Args[1] is the hidden command of the completion scripts; the words to be completed may not be parsed
+	if len(os.Args) > 1 && os.Args[1] == complete.Command {
+		_, files, _ := applyDefaults(f.fs)
+		fail(runComplete(os.Stdout, f.fs, files, os.Args[2:]))
+		return
+	}
+
+	// the command and the flags are before the first "--",
+	// so the commands to be compared can have the same names as the commands of cmdcomp
+	before, after := slicex.Split(os.Args, "--")
+	cmd, err := selectCommand(before)
+	fail(err)
+	fs := cmd.flagSet(g, f)
+	err = fs.Parse(before)
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+	fail(err)
+	// the flags of run contain the global flags, and the files can have the keys of all the flags
+	origins, files, err := applyDefaults(f.fs)
+	fail(err)
+
+	// fs.Arg(0) is the program name
+	args := fs.Args()[1:]
+	if len(args) > 0 && args[0] == cmd.name {
+		args = args[1:]
+	}
+	if *g.displayVersion {
+		cmd, args = findCommand("version"), nil
+	}
+	exit(cmd.run(&app{
+		globals: g,
+		flags:   f,
+		origins: origins,
+		files:   files,
+		args:    args,
+		before:  before,
+		after:   after,
+		w:       os.Stdout,
+	}))
+}
+
+// globalFlags are the flags of all the commands.
+type globalFlags struct {
+	fs             *pflag.FlagSet
+	displayVersion *bool
+	debug          *bool
+	cacheDir       *string
+}
+
+func newGlobalFlags() *globalFlags {
+	fs := pflag.NewFlagSet("global", pflag.ContinueOnError)
+	return &globalFlags{
+		fs:             fs,
+		displayVersion: fs.Bool("version", false, "display version"),
+		debug:          fs.Bool("debug", false, "enable debug logs"),
+		cacheDir:       fs.String("cacheDir", "", "cache directory; default is cmdcomp under the user cache directory"),
+	}
+}
+
+// newFlagSet returns a flag set of the command containing the global flags.
+// The flag sets share the values of the global flags.
+func (g *globalFlags) newFlagSet(name string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.AddFlagSet(g.fs)
 	fs.Usage = func() {
 		fmt.Fprint(os.Stderr, usage)
 		fs.PrintDefaults()
 	}
+	return fs
+}
+
+// runFlags are the flags of run and config.
+type runFlags struct {
+	fs *pflag.FlagSet
+	// newConfig returns the config of run from the parsed flags and their origins.
+	newConfig func(origins defaults.Origins) *config.Config
+}
+
+func newRunFlags(g *globalFlags) *runFlags {
+	fs := g.newFlagSet("run")
 
 	var (
-		displayVersion = fs.Bool("version", false, "display version")
-		debug          = fs.Bool("debug", false, "enable debug logs")
-		showCmdLog     = fs.Bool("showCmdLog", false, "show command logs")
-		workDir        = fs.StringP("workDir", "w", "", "working directory; keep temporary files")
-		shell          = fs.StringP("shell", "s", "bash", "shell command to be executed")
-		delimiter      = fs.StringP("delimiter", "d", "--", `arguments delimiter;
+		showCmdLog = fs.Bool("showCmdLog", false, "show command logs")
+		cmdLogFile = fs.String("cmdLogFile", "", "write command logs to this file as JSON lines")
+		traceFile  = fs.String("traceFile", "", "write command logs to this file as Chrome trace events")
+		workDir    = fs.StringP("workDir", "w", "", "working directory; keep temporary files")
+		shell      = fs.StringP("shell", "s", "bash", "shell command to be executed")
+		delimiter  = fs.StringP("delimiter", "d", "--", `arguments delimiter;
 change the '--' separating COMMON_ARGS, LEFT_ARGS, and RIGHT_ARGS in this`)
 		success = fs.Bool("success", false, `exit successfully even if there are diffs;
-in other words, succeed even if the diff command returns exit status 1`)
+in other words, succeed even if the diff command returns exit status 1; same as --failOn=error unless --failOn is given on the command line`)
+		failOn = fs.String("failOn", config.FailOnDiff, `results to fail on;
+diff: the diffs and the errors, error: only the errors, never: always exit successfully`)
 		useLabel    = fs.BoolP("label", "l", false, "use '--label' option of diff command")
-		interceptor []string
-		preprocess  []string
-		diff        string
+		labelFormat = fs.String("labelFormat", "", `template of the labels of the sides in diff, --brief, the binary outputs and --tui; implies --label;
+available: {{.Side}} (left or right), {{.Name}}, {{.Index}}, {{.Args}}, {{.Vars.KEY}};
+functions: shellquote, join SEP; e.g. '{{.Side}}: {{.Args | shellquote}}'`)
+		leftLabel  = fs.String("leftLabel", "", "template of the left label of diff, prior to --labelFormat; implies --label")
+		rightLabel = fs.String("rightLabel", "", "template of the right label of diff, prior to --labelFormat; implies --label")
+		diffExec   = fs.Bool("diffExec", false, `execute diff command directly, not via shell;
+diff command is split into words like shell, and labels become shell-quoted command lines`)
+		maxOutput      = fs.Int64("maxOutput", 0, "max bytes of the output of each command and preprocess; exceeding fails the comparison; 0 means no limit")
+		truncateOutput = fs.Bool("truncateOutput", false, "truncate the output exceeding --maxOutput with a marker instead of failing")
+		binary         = fs.String("binary", config.BinaryChecksum, `how to compare the outputs containing NUL bytes;
+checksum: compare sha256 without diff command, hexdump: diff hexdumps, text: diff as they are`)
+		brief = fs.String("brief", "", `compare the sha256 of the outputs without diff command;
+text: print a line if the outputs differ (--brief), json: print the hashes and the sizes as a JSON line (--brief=json)`)
+		quiet         = fs.BoolP("quiet", "q", false, "same as --brief but print nothing; exit status tells whether the outputs differ")
+		watchInterval = fs.Duration("watchInterval", 500*time.Millisecond, "interval of polling the files given by --watch")
+		watchDebounce = fs.Duration("watchDebounce", 300*time.Millisecond, "wait for the changes to settle before rerunning")
+		useTUI        = fs.Bool("tui", false, `browse the diff interactively instead of diff command if stdout is a terminal;
+jump between hunks (YAML documents), toggle side-by-side and context, search`)
+		stream = fs.Bool("stream", false, `pipe the outputs of the commands into the preprocess directly, without temporary files;
+the outputs are also written to --workDir if given`)
+		useTemplate = fs.BoolP("template", "t", false, `expand templates in args, preprocess and diff;
+available: {{.Side}} (left, right, sweep or diff), {{.Index}} (0, 1, sweep index or -1), {{.TempDir}}, {{.Vars.KEY}}`)
+		graphFile = fs.String("graph", "", `JSON file of the stage graph replacing left, right, preprocess and diff;
+stages: {"name", "kind", "side", "args", "commands", "inputs", "after"}, kind is source, transform, hook, differ or reporter`)
+		sweep        = fs.String("sweep", "", "variable name to sweep; compare consecutive values of the variable given by --sweepValues or --sweepFile")
+		sweepFile    = fs.String("sweepFile", "", "file containing the values to sweep, one per line")
+		sweepAgainst = fs.String("sweepAgainst", config.SweepAdjacent, "compare each value against the previous one (adjacent) or the first one (first)")
+		useCache     = fs.Bool("cache", false, `cache the outputs of the commands; the key consists of the args, --cacheEnv, the working directory and --cacheFile;
+not available with interceptors, undo and beforeLeft and afterRight hooks, since the sides can share the key`)
+		timeout      = fs.Duration("timeout", 0, "timeout of each command, preprocess pipeline, interceptor and diff; 0 means no timeout")
+		deadline     = fs.Duration("deadline", 0, "timeout of the whole comparison; 0 means no deadline")
+		gracePeriod  = fs.Duration("gracePeriod", 3*time.Second, "duration between SIGTERM and SIGKILL sent to the canceled commands and their children")
+		retry        = fs.Int("retry", 0, "number of retries of the commands")
+		retryPre     = fs.Int("retryPreprocess", 0, "number of retries of the preprocess pipelines")
+		retryInt     = fs.Int("retryInterceptor", 0, "number of retries of each interceptor")
+		retryBackoff = fs.Duration("retryBackoff", time.Second, "wait before the first retry; doubled for each retry")
+		benchRuns    = fs.Int("bench", 0, `run each command this number of times and compare the wall time, the CPU time and the max RSS;
+the comparison is written to stderr unless --benchOnly`)
+		benchOnly    = fs.Bool("benchOnly", false, "compare only the performance, not the outputs; requires --bench")
+		dryRun       = fs.String("dryRun", "", "print the commands to be executed without executing them; text or json (--dryRun=json)")
+		hooks        []string
+		profiles     []string
+		leftIsolated []int
+		undo         []string
+		watchPaths   []string
+		watchInclude []string
+		watchExclude []string
+		cacheEnv     []string
+		cacheFile    []string
+		sweepValues  []string
+		vars         []string
+		interceptor  []string
+		preprocess   []string
+		diff         string
 	)
+	fs.Lookup("dryRun").NoOptDefVal = config.DryRunText
+	fs.Lookup("brief").NoOptDefVal = config.BriefText
 	// workaround: https://github.com/spf13/pflag/issues/370
 	fs.StringArrayVarP(&interceptor, "interceptor", "i", nil,
 		"process after left command and before right command; invoked like 'interceptor'",
@@ -112,47 +350,118 @@ in other words, succeed even if the diff command returns exit status 1`)
 	fs.StringArrayVarP(&preprocess, "preprocess", "p", nil,
 		"process before diff; invoked like 'preprocess'; should read input from stdin; should output result to stdout",
 	)
+	fs.StringArrayVar(&vars, "var", nil,
+		"template variable like 'KEY=LEFT_VALUE,RIGHT_VALUE'; implies --template",
+	)
+	fs.StringSliceVar(&sweepValues, "sweepValues", nil,
+		"comma separated values to sweep",
+	)
+	fs.StringArrayVar(&undo, "undo", nil,
+		`undo command of the interceptor at the same position, like 'git checkout -' for 'git checkout X'; '' for no undo;
+run in reverse order after right command, on error or on interrupt`,
+	)
+	fs.IntSliceVar(&leftIsolated, "leftIsolated", nil,
+		"comma separated indexes of the interceptors not affecting the left command; they run concurrently with the left command",
+	)
+	fs.StringArrayVar(&profiles, defaults.ProfileFlag, nil,
+		`profile bundling flags like preprocess chains and diff command; stackable, later profiles override earlier ones and append to repeatable flags;
+built-in: unified, helm-secrets, k8s-deployments, yaml-gron, json-pretty; see 'config profiles'`,
+	)
+	fs.StringArrayVar(&hooks, "hook", nil,
+		`hook like 'PHASE=COMMAND'; PHASE is setup (before everything), beforeLeft, afterRight or teardown (after everything, even on failure or interrupt)`,
+	)
+	fs.StringArrayVar(&watchPaths, "watch", nil,
+		"file or directory to watch; rerun the comparison on changes until interrupted; only the side referring to the changed files reruns if possible",
+	)
+	fs.StringArrayVar(&watchInclude, "watchInclude", nil,
+		"glob pattern of the names of the files to watch",
+	)
+	fs.StringArrayVar(&watchExclude, "watchExclude", nil,
+		"glob pattern of the names of the files not to watch; exclude the files written by the commands not to rerun endlessly",
+	)
+	fs.StringArrayVar(&cacheEnv, "cacheEnv", nil,
+		"environment variable name to be included in the cache key",
+	)
+	fs.StringArrayVar(&cacheFile, "cacheFile", nil,
+		"file whose hash is included in the cache key",
+	)
 	fs.StringVarP(&diff, "diff", "x", "diff",
 		"diff command; invoked like 'diff LEFT_FILE RIGHT_FILE'",
 	)
 
-	before, after := slicex.Split(os.Args, "--")
-	err := fs.Parse(before)
-	if errors.Is(err, pflag.ErrHelp) {
-		return
-	}
-	fail(err)
-	if *displayVersion {
-		version.Write(os.Stdout)
-		return
+	return &runFlags{
+		fs: fs,
+		newConfig: func(origins defaults.Origins) *config.Config {
+			c := config.NewConfig(os.Stdout, interceptor, preprocess, diff, *shell, *delimiter, *useLabel)
+			c.ShowCmdLog = *showCmdLog
+			c.CmdLogFile = *cmdLogFile
+			c.TraceFile = *traceFile
+			c.Debug = *g.debug
+			c.WorkDir = *workDir
+			c.Template = *useTemplate
+			c.Vars = vars
+			c.Sweep = *sweep
+			c.SweepValues = sweepValues
+			c.SweepFile = *sweepFile
+			c.SweepAgainst = *sweepAgainst
+			c.Cache = *useCache
+			c.CacheDir = *g.cacheDir
+			c.CacheEnv = cacheEnv
+			c.CacheFiles = cacheFile
+			c.Timeout = *timeout
+			c.Deadline = *deadline
+			c.GracePeriod = *gracePeriod
+			c.Retry = *retry
+			c.RetryPreprocess = *retryPre
+			c.RetryInterceptor = *retryInt
+			c.RetryBackoff = *retryBackoff
+			c.Bench = *benchRuns
+			c.BenchOnly = *benchOnly
+			c.DryRun = *dryRun
+			c.DiffExec = *diffExec
+			c.Stream = *stream
+			c.TUI = *useTUI
+			c.Hooks = hooks
+			c.FailOn = *failOn
+			// only --failOn on the command line wins, since the defaults also mark the flags changed
+			if *success && origins["failOn"] != defaults.OriginFlag {
+				c.FailOn = config.FailOnError
+			}
+			c.GraphFile = *graphFile
+			c.InterceptorUndo = undo
+			c.LeftIsolated = leftIsolated
+			c.Watch = watchPaths
+			c.WatchInclude = watchInclude
+			c.WatchExclude = watchExclude
+			c.WatchInterval = *watchInterval
+			c.WatchDebounce = *watchDebounce
+			c.Brief = *brief
+			if *quiet {
+				c.Brief = config.BriefQuiet
+			}
+			c.MaxOutput = *maxOutput
+			c.TruncateOutput = *truncateOutput
+			c.Binary = *binary
+			c.LabelFormat = *labelFormat
+			c.LeftLabel = *leftLabel
+			c.RightLabel = *rightLabel
+			return c
+		},
 	}
+}
 
-	c := config.NewConfig(os.Stdout, interceptor, preprocess, diff, *shell, *delimiter, *useLabel)
-	c.ShowCmdLog = *showCmdLog
-	c.Debug = *debug
-	c.WorkDir = *workDir
-	c.SetupLogger(os.Stderr)
-	slog.Debug("parse args", slog.Any("args", before))
-	slog.Debug("init args", slog.Any("args", after))
-	fail(c.Init(after))
-
-	cj, _ := json.Marshal(c)
-	slog.Debug("config", slog.String("json", string(cj)))
-	if err := run.Main(c); err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			if *success && errors.Is(err, run.ErrDiff) && exitErr.ExitCode() == 1 {
-				return
-			}
-			os.Exit(exitErr.ExitCode())
-		}
-		fail(err)
+// exit exits with the exit status of err.
+func exit(err error) {
+	var s *exitStatus
+	if errors.As(err, &s) {
+		os.Exit(s.status)
 	}
+	fail(err)
 }
 
 func fail(err error) {
 	if err != nil {
 		slog.Error("exit", slog.Any("err", err))
-		os.Exit(1)
+		os.Exit(run.ExitError)
 	}
 }
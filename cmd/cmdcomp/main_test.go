@@ -2,26 +2,35 @@ package main_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/berquerant/cmdcomp/pkg/defaults"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestE2E(t *testing.T) {
-	if !assert.Nil(t, run(t, os.Stdout, "make"), "should build successfully") {
+	root, err := filepath.Abs("../..")
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Nil(t, run(t, os.Stdout, "make", "-C", root), "should build successfully") {
 		return
 	}
 
-	const bin = "./bin/cmdcomp"
+	bin := filepath.Join(root, "bin", "cmdcomp")
+	isolate(t)
 
 	t.Run("version", func(t *testing.T) {
 		assert.Nil(t, run(t, os.Stdout, bin, "--version"))
+		assert.Nil(t, run(t, os.Stdout, bin, "version"))
 	})
 
 	t.Run("delimiter", func(t *testing.T) {
@@ -85,6 +94,62 @@ func TestE2E(t *testing.T) {
 `,
 			wantStatus: 1,
 		},
+		{
+			title: "run",
+			arg:   "run -- echo -- a -- b",
+			want: `1c1
+< a
+---
+> b
+`,
+			wantStatus: 1,
+		},
+		{
+			title:      "run after flags",
+			arg:        "-q run --success -- echo -- a -- b",
+			want:       "",
+			wantStatus: 0,
+		},
+		{
+			title: "args like commands",
+			arg:   "-- echo -- version -- cache",
+			want: `1c1
+< version
+---
+> cache
+`,
+			wantStatus: 1,
+		},
+		{
+			title:      "unknown command",
+			arg:        "bogus -- echo -- a -- a",
+			want:       "",
+			wantStatus: 6,
+		},
+		{
+			title:      "extra args of run",
+			arg:        "run extra -- echo -- a -- a",
+			want:       "",
+			wantStatus: 6,
+		},
+		{
+			title:      "extra args of version",
+			arg:        "version extra",
+			want:       "",
+			wantStatus: 6,
+		},
+		{
+			title:      "flag of run to cache",
+			arg:        "cache list --diff x",
+			want:       "",
+			wantStatus: 6,
+		},
+		{
+			title:      "extra args of cache",
+			arg:        "cache list extra",
+			want:       "",
+			wantStatus: 6,
+		},
 		{
 			title:      "no diff",
 			arg:        "-- echo -- a -- a",
@@ -122,6 +187,78 @@ func TestE2E(t *testing.T) {
 `,
 			wantStatus: 1,
 		},
+		{
+			title:      "brief",
+			arg:        "--brief -- echo -- a -- b",
+			want:       "Outputs left and right differ\n",
+			wantStatus: 1,
+		},
+		{
+			title:      "quiet with success",
+			arg:        "-q --success -- echo -- a -- b",
+			want:       "",
+			wantStatus: 0,
+		},
+		{
+			title:      "fail on diff with success",
+			arg:        "--success --failOn=diff -q -- echo -- a -- b",
+			want:       "",
+			wantStatus: 1,
+		},
+		{
+			title:      "fail on error",
+			arg:        "--failOn=error -q -- echo -- a -- b",
+			want:       "",
+			wantStatus: 0,
+		},
+		{
+			title:      "left failed",
+			arg:        "-- bash -c -- 'exit 1' -- 'echo b'",
+			want:       "",
+			wantStatus: 3,
+		},
+		{
+			title:      "left failed never fails",
+			arg:        "--failOn=never -- bash -c -- 'exit 1' -- 'echo b'",
+			want:       "",
+			wantStatus: 0,
+		},
+		{
+			title:      "preprocess failed",
+			arg:        "-p 'exit 1' -- echo -- a -- b",
+			want:       "",
+			wantStatus: 4,
+		},
+		{
+			title:      "diff failed",
+			arg:        "-x 'diff --no-such-flag' -- echo -- a -- b",
+			want:       "",
+			wantStatus: 2,
+		},
+		{
+			title:      "timeout",
+			arg:        "--timeout 100ms -- sleep -- 0 -- 10",
+			want:       "",
+			wantStatus: 5,
+		},
+		{
+			title:      "interceptor failed",
+			arg:        "-i 'exit 1' -- echo -- a -- b",
+			want:       "",
+			wantStatus: 6,
+		},
+		{
+			title:      "invalid failOn",
+			arg:        "--failOn=always -- echo -- a -- b",
+			want:       "",
+			wantStatus: 6,
+		},
+		{
+			title:      "cache with interceptor",
+			arg:        "--cache --cacheDir \"$(mktemp -d)\" -i 'true' -- echo -- a -- a",
+			want:       "",
+			wantStatus: 6,
+		},
 		{
 			title: "preprocess sed",
 			arg:   `-p 'sed "s|a|c|"' -- echo -- a -- b`,
@@ -159,6 +296,133 @@ func TestE2E(t *testing.T) {
 		})
 	}
 
+	t.Run("success over failOn from env", func(t *testing.T) {
+		t.Setenv("CMDCOMP_FAIL_ON", "diff")
+		assert.Nil(t, run(t, io.Discard, bin, "--success", "-q", "--", "echo", "--", "a", "--", "b"))
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.Nil(t, run(t, os.Stdout, bin, "--cache", "--cacheDir", dir, "--", "echo", "--", "a", "--", "a"))
+		var got bytes.Buffer
+		assert.Nil(t, run(t, &got, bin, "--cacheDir", dir, "cache", "list"))
+		assert.Contains(t, got.String(), "echo a")
+		got.Reset()
+		assert.Nil(t, run(t, &got, bin, "--cacheDir", dir, "cache", "prune"))
+		assert.Equal(t, 1, bytes.Count(got.Bytes(), []byte("\n")), "left and right share the same key without interceptors")
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		var (
+			project = t.TempDir()
+			user    = t.TempDir()
+		)
+		assert.Nil(t, os.WriteFile(filepath.Join(project, ".cmdcomp.json"), []byte(`{"diff": "diff -u --label L --label R", "preprocess": ["tr a-z A-Z"]}`), 0o600))
+		assert.Nil(t, os.MkdirAll(filepath.Join(user, "cmdcomp"), 0o755))
+		writeUser := func(trusted bool) {
+			t.Helper()
+			trustedProjects := []string{}
+			if trusted {
+				trustedProjects = []string{project}
+			}
+			b, _ := json.Marshal(map[string]any{
+				"diff":            "diff -c",
+				"shell":           "sh",
+				"trustedProjects": trustedProjects,
+			})
+			assert.Nil(t, os.WriteFile(filepath.Join(user, "cmdcomp", "config.json"), b, 0o600))
+		}
+		t.Setenv("XDG_CONFIG_HOME", user)
+		t.Setenv("CMDCOMP_SHELL", "bash")
+
+		script := fmt.Sprintf(`cd %[2]s && %[1]q -- echo -- a -- b`, bin, project)
+		var got bytes.Buffer
+		writeUser(false)
+		err := run(t, &got, "bash", "-c", script)
+		var exitErr *exec.ExitError
+		if assert.True(t, errors.As(err, &exitErr)) {
+			assert.Equal(t, 1, exitErr.ExitCode())
+		}
+		assert.Contains(t, got.String(), "! a\n--- 1 ----\n! b\n", "the untrusted project file should be ignored")
+
+		got.Reset()
+		writeUser(true)
+		err = run(t, &got, "bash", "-c", script)
+		if assert.True(t, errors.As(err, &exitErr)) {
+			assert.Equal(t, 1, exitErr.ExitCode())
+		}
+		assert.Equal(t, `--- L
++++ R
+@@ -1 +1 @@
+-A
++B
+`, got.String())
+
+		got.Reset()
+		assert.Nil(t, run(t, &got, "bash", "-c", fmt.Sprintf(`cd %[2]s && %[1]q --label config show`, bin, project)))
+		for _, want := range []string{
+			"diff ",
+			"project " + filepath.Join(project, ".cmdcomp.json"),
+			"env CMDCOMP_SHELL",
+		} {
+			assert.Contains(t, got.String(), want)
+		}
+		assert.Regexp(t, `(?m)^label\s+true\s+flag$`, got.String())
+		assert.Regexp(t, `(?m)^delimiter\s+--\s+default$`, got.String())
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		project := t.TempDir()
+		assert.Nil(t, os.WriteFile(filepath.Join(project, ".cmdcomp.json"), []byte(`{"profiles": {"upper": {"preprocess": ["tr a-z A-Z"], "diff": "diff -u --label L --label R"}}}`), 0o600))
+		user := t.TempDir()
+		assert.Nil(t, os.MkdirAll(filepath.Join(user, "cmdcomp"), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(user, "cmdcomp", "config.json"), []byte(fmt.Sprintf(`{"trustedProjects": [%q]}`, project)), 0o600))
+		t.Setenv("XDG_CONFIG_HOME", user)
+
+		script := fmt.Sprintf(`cd %[2]s && %[1]q --profile upper -p 'sed s/b/c/' -- echo -- a -- b`, bin, project)
+		var got bytes.Buffer
+		err := run(t, &got, "bash", "-c", script)
+		var exitErr *exec.ExitError
+		if assert.True(t, errors.As(err, &exitErr)) {
+			assert.Equal(t, 1, exitErr.ExitCode())
+		}
+		assert.Equal(t, `--- L
++++ R
+@@ -1 +1 @@
+-a
++c
+`, got.String(), "--preprocess should override the profile")
+
+		got.Reset()
+		script = fmt.Sprintf(`cd %[2]s && %[1]q --profile nothing -- echo -- a -- b`, bin, project)
+		err = run(t, &got, "bash", "-c", script)
+		if assert.True(t, errors.As(err, &exitErr)) {
+			assert.Equal(t, 6, exitErr.ExitCode())
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		var got bytes.Buffer
+		assert.Nil(t, run(t, &got, bin, "completion", "bash"))
+		assert.Nil(t, run(t, os.Stdout, "bash", "-n", "-c", got.String()), "should be a valid bash script")
+
+		script := `PATH="` + filepath.Dir(bin) + `:$PATH"
+source <(cmdcomp completion bash)
+COMP_WORDS=(cmdcomp --failOn = n); COMP_CWORD=3
+_cmdcomp
+echo "${COMPREPLY[@]}"
+COMP_WORDS=(cmdcomp --profile yaml); COMP_CWORD=2
+_cmdcomp
+echo "${COMPREPLY[@]}"`
+		got.Reset()
+		assert.Nil(t, run(t, &got, "bash", "-c", script))
+		assert.Equal(t, "never\nyaml-gron\n", got.String())
+
+		got.Reset()
+		assert.Nil(t, run(t, &got, bin, "__complete", "-x", "diff", "--", "helm", "template", "--", "--version", "1", "--", "--ver"))
+		assert.Equal(t, ":delegate 3 5 9\n", got.String())
+	})
+
 	t.Run("interceptor", func(t *testing.T) {
 		out := filepath.Join(t.TempDir(), "out")
 		arg := fmt.Sprintf(
@@ -181,10 +445,23 @@ func TestE2E(t *testing.T) {
 	})
 }
 
+// isolate runs the commands in a temporary directory
+// without the user file, the project files and CMDCOMP_* environment variables of the developer.
+func isolate(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, x := range os.Environ() {
+		if k, _, _ := strings.Cut(x, "="); strings.HasPrefix(k, defaults.EnvPrefix) {
+			t.Setenv(k, "") // restore after the test
+			assert.Nil(t, os.Unsetenv(k))
+		}
+	}
+	t.Chdir(t.TempDir())
+}
+
 func run(t *testing.T, stdout io.Writer, name string, arg ...string) error {
 	t.Helper()
 	c := exec.Command(name, arg...)
-	c.Dir = "../.."
 	c.Stdout = stdout
 	c.Stderr = os.Stderr
 	t.Logf("run:%v", c.Args)
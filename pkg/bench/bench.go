@@ -0,0 +1,129 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Sample is the resource usage of a run.
+type Sample struct {
+	Wall time.Duration
+	User time.Duration
+	Sys  time.Duration
+	// MaxRSS is the maximum resident set size in KiB.
+	MaxRSS int64
+}
+
+func NewSample(wall time.Duration, state *os.ProcessState) Sample {
+	s := Sample{
+		Wall: wall,
+	}
+	if state == nil {
+		return s
+	}
+	s.User = state.UserTime()
+	s.Sys = state.SystemTime()
+	if x, ok := state.SysUsage().(*syscall.Rusage); ok {
+		s.MaxRSS = int64(x.Maxrss)
+		if runtime.GOOS == "darwin" {
+			// bytes on darwin
+			s.MaxRSS /= 1024
+		}
+	}
+	return s
+}
+
+// Stat is the summary of the values.
+type Stat struct {
+	Mean   float64
+	Stddev float64
+}
+
+// NewStat returns the mean and the sample standard deviation of xs.
+func NewStat(xs []float64) Stat {
+	if len(xs) == 0 {
+		return Stat{}
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	if len(xs) < 2 {
+		return Stat{Mean: mean}
+	}
+	var sq float64
+	for _, x := range xs {
+		sq += (x - mean) * (x - mean)
+	}
+	return Stat{
+		Mean:   mean,
+		Stddev: math.Sqrt(sq / float64(len(xs)-1)),
+	}
+}
+
+// Metric is the comparison of a measurement between left and right.
+type Metric struct {
+	Name  string
+	Left  Stat
+	Right Stat
+}
+
+// Change returns the relative change of the mean from left to right in percent.
+// Returns NaN if the mean of left is 0.
+func (m Metric) Change() float64 {
+	if m.Left.Mean == 0 {
+		return math.NaN()
+	}
+	return (m.Right.Mean - m.Left.Mean) / m.Left.Mean * 100
+}
+
+// Compare summarizes the samples of left and right.
+func Compare(left, right []Sample) []Metric {
+	newMetric := func(name string, f func(Sample) float64) Metric {
+		return Metric{
+			Name:  name,
+			Left:  NewStat(values(left, f)),
+			Right: NewStat(values(right, f)),
+		}
+	}
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return []Metric{
+		newMetric("wall_ms", func(s Sample) float64 { return ms(s.Wall) }),
+		newMetric("user_ms", func(s Sample) float64 { return ms(s.User) }),
+		newMetric("sys_ms", func(s Sample) float64 { return ms(s.Sys) }),
+		newMetric("maxrss_kb", func(s Sample) float64 { return float64(s.MaxRSS) }),
+	}
+}
+
+func values(xs []Sample, f func(Sample) float64) []float64 {
+	ys := make([]float64, len(xs))
+	for i, x := range xs {
+		ys[i] = f(x)
+	}
+	return ys
+}
+
+// Write writes the metrics as a table.
+func Write(w io.Writer, runs int, metrics []Metric) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "# Benchmark (%d runs)\n", runs)
+	_, _ = fmt.Fprintln(tw, "METRIC\tLEFT MEAN\tLEFT STDDEV\tRIGHT MEAN\tRIGHT STDDEV\tCHANGE")
+	for _, m := range metrics {
+		change := "-"
+		if x := m.Change(); !math.IsNaN(x) {
+			change = fmt.Sprintf("%+.1f%%", x)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%.1f\t%.1f\t%.1f\t%.1f\t%s\n",
+			m.Name, m.Left.Mean, m.Left.Stddev, m.Right.Mean, m.Right.Stddev, change)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,71 @@
+package bench_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/berquerant/cmdcomp/pkg/bench"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStat(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		xs    []float64
+		want  bench.Stat
+	}{
+		{
+			title: "empty",
+			want:  bench.Stat{},
+		},
+		{
+			title: "single",
+			xs:    []float64{3},
+			want:  bench.Stat{Mean: 3},
+		},
+		{
+			title: "multiple",
+			xs:    []float64{2, 4, 4, 4, 5, 5, 7, 9},
+			want:  bench.Stat{Mean: 5, Stddev: math.Sqrt(32.0 / 7)},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			got := bench.NewStat(tc.xs)
+			assert.InDelta(t, tc.want.Mean, got.Mean, 1e-9)
+			assert.InDelta(t, tc.want.Stddev, got.Stddev, 1e-9)
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	left := []bench.Sample{
+		{Wall: 10 * time.Millisecond, MaxRSS: 100},
+		{Wall: 30 * time.Millisecond, MaxRSS: 100},
+	}
+	right := []bench.Sample{
+		{Wall: 30 * time.Millisecond, MaxRSS: 150},
+		{Wall: 30 * time.Millisecond, MaxRSS: 150},
+	}
+	metrics := bench.Compare(left, right)
+	assert.Len(t, metrics, 4)
+
+	wall := metrics[0]
+	assert.Equal(t, "wall_ms", wall.Name)
+	assert.InDelta(t, 20, wall.Left.Mean, 1e-9)
+	assert.InDelta(t, 30, wall.Right.Mean, 1e-9)
+	assert.InDelta(t, 50, wall.Change(), 1e-9)
+
+	assert.True(t, math.IsNaN(metrics[1].Change()), "user time is 0")
+
+	var b bytes.Buffer
+	assert.Nil(t, bench.Write(&b, 2, metrics))
+	assert.Equal(t, `# Benchmark (2 runs)
+METRIC     LEFT MEAN  LEFT STDDEV  RIGHT MEAN  RIGHT STDDEV  CHANGE
+wall_ms    20.0       14.1         30.0        0.0           +50.0%
+user_ms    0.0        0.0          0.0         0.0           -
+sys_ms     0.0        0.0          0.0         0.0           -
+maxrss_kb  100.0      0.0          150.0       0.0           +50.0%
+`, b.String())
+}
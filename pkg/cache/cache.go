@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+var ErrCache = errors.New("Cache")
+
+// DefaultDir returns the cache directory under the user cache directory.
+func DefaultDir() (string, error) {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "cmdcomp"), nil
+}
+
+// Key identifies the output of a command.
+type Key struct {
+	Args []string          `json:"args"`
+	Env  map[string]string `json:"env,omitempty"`
+	Dir  string            `json:"dir"`
+	// Files are the hashes of the input files.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// NewKey returns the key of the command with the current working directory,
+// the values of the environment variables and the hashes of the files.
+func NewKey(args, envNames, files []string) (*Key, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{
+		Args: args,
+		Dir:  dir,
+	}
+	if len(envNames) > 0 {
+		key.Env = map[string]string{}
+		for _, x := range envNames {
+			key.Env[x] = os.Getenv(x)
+		}
+	}
+	if len(files) > 0 {
+		key.Files = map[string]string{}
+		for _, x := range files {
+			h, err := hashFile(x)
+			if err != nil {
+				return nil, fmt.Errorf("%w: hash %s: %w", ErrCache, x, err)
+			}
+			key.Files[x] = h
+		}
+	}
+	return key, nil
+}
+
+// Hash returns the hex encoded sha256 of the key.
+func (k Key) Hash() string {
+	// json.Marshal sorts the map keys
+	b, _ := json.Marshal(k)
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Entry is a cached output.
+type Entry struct {
+	Hash    string    `json:"hash"`
+	Key     *Key      `json:"key"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	// Path is the file containing the output.
+	Path string `json:"path"`
+}
+
+const (
+	outFile  = "out"
+	metaFile = "meta.json"
+)
+
+// Cache stores the outputs of the commands in a directory.
+//
+// Each entry is a directory named by the hash of the key,
+// containing the output and the metadata.
+type Cache struct {
+	dir string
+}
+
+func New(dir string) *Cache {
+	return &Cache{
+		dir: dir,
+	}
+}
+
+func (c Cache) Dir() string {
+	return c.dir
+}
+
+// Get returns the entry of the key.
+// Returns false if not found.
+func (c Cache) Get(key *Key) (*Entry, bool, error) {
+	e, err := c.Inspect(key.Hash())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return e, true, nil
+}
+
+// Put stores the content of src as the output of the key.
+func (c Cache) Put(key *Key, src string) (*Entry, error) {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(c.dir, ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	size, err := copyFile(filepath.Join(tmpDir, outFile), src)
+	if err != nil {
+		return nil, err
+	}
+	hash := key.Hash()
+	e := &Entry{
+		Hash:    hash,
+		Key:     key,
+		Created: time.Now(),
+		Size:    size,
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, metaFile), b, 0o644); err != nil {
+		return nil, err
+	}
+	dst := filepath.Join(c.dir, hash)
+	if err := os.Rename(tmpDir, dst); err != nil {
+		// the same key may be stored concurrently
+		if _, statErr := os.Stat(dst); statErr != nil {
+			return nil, err
+		}
+	}
+	e.Path = filepath.Join(dst, outFile)
+	return e, nil
+}
+
+func copyFile(dst, src string) (int64, error) {
+	r, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer w.Close()
+	return io.Copy(w, r)
+}
+
+// Inspect returns the entry of the hash.
+func (c Cache) Inspect(hash string) (*Entry, error) {
+	dir := filepath.Join(c.dir, hash)
+	b, err := os.ReadFile(filepath.Join(dir, metaFile))
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("%w: invalid entry %s: %w", ErrCache, hash, err)
+	}
+	e.Path = filepath.Join(dir, outFile)
+	return &e, nil
+}
+
+// List returns all entries, oldest first.
+func (c Cache) List() ([]*Entry, error) {
+	xs, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	es := []*Entry{}
+	for _, x := range xs {
+		if !x.IsDir() || x.Name()[0] == '.' {
+			continue
+		}
+		e, err := c.Inspect(x.Name())
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	slices.SortFunc(es, func(a, b *Entry) int {
+		return a.Created.Compare(b.Created)
+	})
+	return es, nil
+}
+
+// Prune removes the entries created before the time and returns them.
+func (c Cache) Prune(before time.Time) ([]*Entry, error) {
+	es, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	removed := []*Entry{}
+	for _, e := range es {
+		if !e.Created.Before(before) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.dir, e.Hash)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
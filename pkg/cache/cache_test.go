@@ -0,0 +1,82 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/berquerant/cmdcomp/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	t.Setenv("CMDCOMP_CACHE_TEST", "v1")
+	file := filepath.Join(t.TempDir(), "input")
+	assert.Nil(t, os.WriteFile(file, []byte("a"), 0o644))
+
+	newHash := func() string {
+		t.Helper()
+		k, err := cache.NewKey([]string{"echo", "a"}, []string{"CMDCOMP_CACHE_TEST"}, []string{file})
+		assert.Nil(t, err)
+		return k.Hash()
+	}
+
+	h := newHash()
+	assert.Equal(t, h, newHash(), "same key")
+
+	t.Setenv("CMDCOMP_CACHE_TEST", "v2")
+	h2 := newHash()
+	assert.NotEqual(t, h, h2, "env changed")
+
+	assert.Nil(t, os.WriteFile(file, []byte("b"), 0o644))
+	assert.NotEqual(t, h2, newHash(), "file changed")
+
+	_, err := cache.NewKey([]string{"echo"}, nil, []string{filepath.Join(t.TempDir(), "none")})
+	assert.ErrorIs(t, err, cache.ErrCache)
+}
+
+func TestCache(t *testing.T) {
+	c := cache.New(filepath.Join(t.TempDir(), "cache"))
+	src := filepath.Join(t.TempDir(), "out")
+	assert.Nil(t, os.WriteFile(src, []byte("output"), 0o644))
+	key, err := cache.NewKey([]string{"echo", "output"}, nil, nil)
+	assert.Nil(t, err)
+
+	es, err := c.List()
+	assert.Nil(t, err)
+	assert.Empty(t, es, "no cache dir")
+
+	_, ok, err := c.Get(key)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	put, err := c.Put(key, src)
+	assert.Nil(t, err)
+	assert.Equal(t, key.Hash(), put.Hash)
+	assert.Equal(t, int64(6), put.Size)
+
+	got, ok, err := c.Get(key)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, put.Path, got.Path)
+	b, err := os.ReadFile(got.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, "output", string(b))
+
+	es, err = c.List()
+	assert.Nil(t, err)
+	assert.Len(t, es, 1)
+	assert.Equal(t, key.Args, es[0].Key.Args)
+
+	removed, err := c.Prune(time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Empty(t, removed, "not old enough")
+
+	removed, err = c.Prune(time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, removed, 1)
+	_, ok, err = c.Get(key)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,216 @@
+// Package complete completes the command line of cmdcomp for the shell completion scripts.
+package complete
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Delimiter separates the flags of cmdcomp and the args of the wrapped command.
+const Delimiter = "--"
+
+// Completer completes the words of the command line.
+type Completer struct {
+	FlagSet *pflag.FlagSet
+	// DelimiterFlag is the name of the flag changing the delimiter of COMMON_ARGS, LEFT_ARGS and RIGHT_ARGS.
+	DelimiterFlag string
+	// Subcommands are the candidates of the first positional argument and their arguments.
+	Subcommands map[string][]string
+	// Values are the candidates of the values of the flags by names.
+	Values map[string][]string
+}
+
+// Result is the completion of the current word.
+//
+// Delegate is set if the current word belongs to the wrapped command:
+// the words to be completed by the wrapped command are words[A:B] + words[C:]
+// where [A, B, C] is Delegate, i.e. COMMON_ARGS and the current args.
+type Result struct {
+	Delegate   []int
+	File       bool
+	Candidates []string
+}
+
+// Write writes the result for the completion scripts:
+// ":delegate A B C", ":file" or the candidates, one per line.
+func (r Result) Write(w io.Writer) error {
+	switch {
+	case len(r.Delegate) > 0:
+		_, err := fmt.Fprintf(w, ":delegate %d %d %d\n", r.Delegate[0], r.Delegate[1], r.Delegate[2])
+		return err
+	case r.File:
+		_, err := fmt.Fprintln(w, ":file")
+		return err
+	default:
+		for _, x := range r.Candidates {
+			if _, err := fmt.Fprintln(w, x); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Complete completes the last word of words, the args of cmdcomp up to the cursor.
+func (c Completer) Complete(words []string) *Result {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	if i := slices.Index(words[:len(words)-1], Delimiter); i >= 0 {
+		return c.delegate(words, i)
+	}
+
+	words = joinEquals(words)
+	var (
+		cur  = words[len(words)-1]
+		prev = words[:len(words)-1]
+	)
+	if len(prev) > 0 {
+		if f := c.lookup(prev[len(prev)-1]); f != nil && needsValue(f) {
+			return c.values(f, "", cur)
+		}
+	}
+	if name, value, ok := strings.Cut(cur, "="); ok && strings.HasPrefix(cur, "--") {
+		if f := c.FlagSet.Lookup(strings.TrimPrefix(name, "--")); f != nil {
+			return c.values(f, name+"=", value)
+		}
+		return &Result{}
+	}
+	if strings.HasPrefix(cur, "-") {
+		var xs []string
+		c.FlagSet.VisitAll(func(f *pflag.Flag) {
+			if f.Hidden || f.Deprecated != "" {
+				return
+			}
+			xs = append(xs, "--"+f.Name)
+		})
+		return &Result{Candidates: filter(xs, cur)}
+	}
+
+	args := c.positionals(prev)
+	if len(args) == 0 {
+		xs := []string{Delimiter}
+		for name := range c.Subcommands {
+			xs = append(xs, name)
+		}
+		slices.Sort(xs)
+		return &Result{Candidates: filter(xs, cur)}
+	}
+	if len(args) == 1 {
+		return &Result{Candidates: filter(c.Subcommands[args[0]], cur)}
+	}
+	return &Result{}
+}
+
+// delegate returns the words after the delimiter at i to be completed by the wrapped command.
+func (c Completer) delegate(words []string, i int) *Result {
+	delimiter := c.delimiter(words[:i])
+	start := i + 1
+	// the indexes of the delimiters of COMMON_ARGS, LEFT_ARGS and RIGHT_ARGS before the current word
+	var ds []int
+	for j := start; j < len(words)-1; j++ {
+		if words[j] == delimiter {
+			ds = append(ds, j)
+		}
+	}
+	if len(ds) == 0 {
+		return &Result{Delegate: []int{start, start, start}}
+	}
+	return &Result{Delegate: []int{start, ds[0], ds[len(ds)-1] + 1}}
+}
+
+// delimiter returns the value of the delimiter flag in the flags of cmdcomp.
+func (c Completer) delimiter(words []string) string {
+	f := c.FlagSet.Lookup(c.DelimiterFlag)
+	if f == nil {
+		return Delimiter
+	}
+	d := f.DefValue
+	for i, w := range words {
+		switch {
+		case w == "--"+f.Name || (f.Shorthand != "" && w == "-"+f.Shorthand):
+			if i+1 < len(words) {
+				d = words[i+1]
+			}
+		case strings.HasPrefix(w, "--"+f.Name+"="):
+			d = strings.TrimPrefix(w, "--"+f.Name+"=")
+		}
+	}
+	return d
+}
+
+func (c Completer) values(f *pflag.Flag, prefix, cur string) *Result {
+	xs, ok := c.Values[f.Name]
+	if !ok {
+		return &Result{File: true}
+	}
+	var r Result
+	for _, x := range filter(xs, cur) {
+		r.Candidates = append(r.Candidates, prefix+x)
+	}
+	return &r
+}
+
+// lookup returns the flag of the word like --name or -n.
+func (c Completer) lookup(word string) *pflag.Flag {
+	switch {
+	case strings.HasPrefix(word, "--"):
+		return c.FlagSet.Lookup(strings.TrimPrefix(word, "--"))
+	case strings.HasPrefix(word, "-") && len(word) == 2:
+		return c.FlagSet.ShorthandLookup(word[1:])
+	default:
+		return nil
+	}
+}
+
+// positionals returns the words other than the flags and their values.
+func (c Completer) positionals(words []string) []string {
+	var xs []string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			xs = append(xs, w)
+			continue
+		}
+		if f := c.lookup(w); f != nil && needsValue(f) {
+			i++ // skip the value
+		}
+	}
+	return xs
+}
+
+func needsValue(f *pflag.Flag) bool {
+	return f.NoOptDefVal == ""
+}
+
+// joinEquals joins the words split at '=' by bash, e.g. --flag = value.
+func joinEquals(words []string) []string {
+	var xs []string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if i+1 < len(words) && words[i+1] == "=" && strings.HasPrefix(w, "--") {
+			w += "="
+			i++
+			if i+1 < len(words) {
+				w += words[i+1]
+				i++
+			}
+		}
+		xs = append(xs, w)
+	}
+	return xs
+}
+
+func filter(xs []string, prefix string) []string {
+	var ys []string
+	for _, x := range xs {
+		if strings.HasPrefix(x, prefix) {
+			ys = append(ys, x)
+		}
+	}
+	return ys
+}
@@ -0,0 +1,174 @@
+package complete_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/berquerant/cmdcomp/pkg/complete"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	_ = fs.StringP("diff", "x", "diff", "")
+	_ = fs.StringP("delimiter", "d", "--", "")
+	_ = fs.StringP("workDir", "w", "", "")
+	_ = fs.BoolP("label", "l", false, "")
+	_ = fs.String("brief", "", "")
+	fs.Lookup("brief").NoOptDefVal = "text"
+	_ = fs.StringArray("profile", nil, "")
+	c := complete.Completer{
+		FlagSet:       fs,
+		DelimiterFlag: "delimiter",
+		Subcommands: map[string][]string{
+			"cache":      {"list", "show", "prune"},
+			"completion": {"bash", "zsh", "fish"},
+		},
+		Values: map[string][]string{
+			"brief":   {"text", "json", "quiet"},
+			"profile": {"helm-secrets", "json-pretty", "yaml-gron"},
+		},
+	}
+
+	for _, tc := range []struct {
+		title string
+		words []string
+		want  *complete.Result
+	}{
+		{
+			title: "empty",
+			want:  &complete.Result{Candidates: []string{"--", "cache", "completion"}},
+		},
+		{
+			title: "subcommand",
+			words: []string{"c"},
+			want:  &complete.Result{Candidates: []string{"cache", "completion"}},
+		},
+		{
+			title: "subcommand args",
+			words: []string{"-l", "completion", "z"},
+			want:  &complete.Result{Candidates: []string{"zsh"}},
+		},
+		{
+			title: "after subcommand args",
+			words: []string{"cache", "show", ""},
+			want:  &complete.Result{},
+		},
+		{
+			title: "flags",
+			words: []string{"--d"},
+			want:  &complete.Result{Candidates: []string{"--delimiter", "--diff"}},
+		},
+		{
+			title: "flag values",
+			words: []string{"--profile", "j"},
+			want:  &complete.Result{Candidates: []string{"json-pretty"}},
+		},
+		{
+			title: "flag values with equal",
+			words: []string{"--profile="},
+			want:  &complete.Result{Candidates: []string{"--profile=helm-secrets", "--profile=json-pretty", "--profile=yaml-gron"}},
+		},
+		{
+			title: "flag values split by bash",
+			words: []string{"--brief", "=", "q"},
+			want:  &complete.Result{Candidates: []string{"--brief=quiet"}},
+		},
+		{
+			title: "optional value is not completed after space",
+			words: []string{"--brief", "c"},
+			want:  &complete.Result{Candidates: []string{"cache", "completion"}},
+		},
+		{
+			title: "file",
+			words: []string{"-w", ""},
+			want:  &complete.Result{File: true},
+		},
+		{
+			title: "positional after flag value",
+			words: []string{"-x", "cache", ""},
+			want:  &complete.Result{Candidates: []string{"--", "cache", "completion"}},
+		},
+		{
+			title: "command",
+			words: []string{"-l", "--", "hel"},
+			want:  &complete.Result{Delegate: []int{2, 2, 2}},
+		},
+		{
+			title: "common args",
+			words: []string{"--", "helm", "templ"},
+			want:  &complete.Result{Delegate: []int{1, 1, 1}},
+		},
+		{
+			title: "delimiter is current",
+			words: []string{"--", "helm", "--"},
+			want:  &complete.Result{Delegate: []int{1, 1, 1}},
+		},
+		{
+			title: "left args",
+			words: []string{"--", "helm", "template", "--", "--ver"},
+			want:  &complete.Result{Delegate: []int{1, 3, 4}},
+		},
+		{
+			title: "right args",
+			words: []string{"--", "helm", "template", "--", "--version", "1", "--", "--ver"},
+			want:  &complete.Result{Delegate: []int{1, 3, 7}},
+		},
+		{
+			title: "changed delimiter",
+			words: []string{"-d", "---", "--", "echo", "--", "a", "---", "b", "---", ""},
+			want:  &complete.Result{Delegate: []int{3, 6, 9}},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			assert.Equal(t, tc.want, c.Complete(tc.words))
+		})
+	}
+}
+
+func TestResultWrite(t *testing.T) {
+	for _, tc := range []struct {
+		title  string
+		result complete.Result
+		want   string
+	}{
+		{
+			title:  "delegate",
+			result: complete.Result{Delegate: []int{1, 3, 7}},
+			want:   ":delegate 1 3 7\n",
+		},
+		{
+			title:  "file",
+			result: complete.Result{File: true},
+			want:   ":file\n",
+		},
+		{
+			title:  "candidates",
+			result: complete.Result{Candidates: []string{"a", "b"}},
+			want:   "a\nb\n",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			var b bytes.Buffer
+			assert.Nil(t, tc.result.Write(&b))
+			assert.Equal(t, tc.want, b.String())
+		})
+	}
+}
+
+func TestScript(t *testing.T) {
+	for _, shell := range complete.Shells {
+		s, err := complete.Script(shell, "cmd-comp")
+		assert.Nil(t, err)
+		assert.Contains(t, s, "cmd-comp __complete")
+		assert.Contains(t, s, "_cmd_comp")
+		assert.NotContains(t, s, "PROGRAM")
+	}
+	_, err := complete.Script("pwsh", "cmdcomp")
+	assert.ErrorIs(t, err, complete.ErrComplete)
+
+	s, err := complete.Script("fish", "cmdcomp")
+	assert.Nil(t, err)
+	assert.Contains(t, s, "if test $idx[3] -gt $idx[2]", "the empty COMMON_ARGS should not be counted down by BSD seq")
+}
@@ -0,0 +1,134 @@
+package complete
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrComplete = errors.New("Complete")
+
+// Command is the hidden subcommand called by the completion scripts
+// with the args of cmdcomp up to the cursor.
+const Command = "__complete"
+
+// Shells are the shells supported by Script.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Script returns the completion script of the shell for the program name.
+func Script(shell, name string) (string, error) {
+	var s string
+	switch shell {
+	case "bash":
+		s = bashScript
+	case "zsh":
+		s = zshScript
+	case "fish":
+		s = fishScript
+	default:
+		return "", fmt.Errorf("%w: unknown shell %q, should be one of %s", ErrComplete, shell, strings.Join(Shells, ", "))
+	}
+	return strings.NewReplacer(
+		"PROGRAM", name,
+		"COMPLETE", Command,
+		"FUNC", "_"+strings.ReplaceAll(name, "-", "_"),
+	).Replace(s), nil
+}
+
+// bashScript delegates to _command_offset of bash-completion if available.
+const bashScript = `# bash completion for PROGRAM
+# source <(PROGRAM completion bash)
+FUNC() {
+    local -a args=("${COMP_WORDS[@]:1:COMP_CWORD}")
+    local -a out
+    mapfile -t out < <(PROGRAM COMPLETE "${args[@]}" 2>/dev/null)
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    case "${out[0]}" in
+    ":delegate "*)
+        local _ a b c
+        read -r _ a b c <<< "${out[0]}"
+        local -a words=("${args[@]:a:b-a}" "${args[@]:c}")
+        COMP_WORDS=("${words[@]}")
+        COMP_CWORD=$((${#words[@]} - 1))
+        COMP_LINE="${words[*]}"
+        COMP_POINT=${#COMP_LINE}
+        if declare -F _command_offset > /dev/null; then
+            _command_offset 0
+        elif [[ ${COMP_CWORD} -eq 0 ]]; then
+            mapfile -t COMPREPLY < <(compgen -c -- "${words[COMP_CWORD]}" | sort -u)
+        else
+            mapfile -t COMPREPLY < <(compgen -f -- "${words[COMP_CWORD]}")
+        fi
+        ;;
+    ":file")
+        [[ "${cur}" == "=" ]] && cur=""
+        mapfile -t COMPREPLY < <(compgen -f -- "${cur}")
+        ;;
+    *)
+        COMPREPLY=("${out[@]}")
+        # bash splits --flag=value into --flag, = and value
+        if [[ "${cur}" == "=" || "${COMP_WORDS[COMP_CWORD-1]}" == "=" ]]; then
+            COMPREPLY=("${COMPREPLY[@]#*=}")
+        fi
+        ;;
+    esac
+}
+complete -o default -F FUNC PROGRAM
+`
+
+const zshScript = `#compdef PROGRAM
+# source <(PROGRAM completion zsh)
+FUNC() {
+    local -a args out
+    args=("${(@)words[2,CURRENT]}")
+    out=("${(@f)$(PROGRAM COMPLETE "${(@)args}" 2>/dev/null)}")
+    case "${out[1]}" in
+    ":delegate "*)
+        local -a idx
+        idx=(${=out[1]})
+        words=("${(@)args[idx[2]+1,idx[3]]}" "${(@)args[idx[4]+1,-1]}")
+        CURRENT=${#words}
+        _normal
+        ;;
+    ":file")
+        _files
+        ;;
+    *)
+        [[ -n "${out[1]}" ]] && compadd -Q -- "${(@)out}"
+        ;;
+    esac
+}
+compdef FUNC PROGRAM
+`
+
+const fishScript = `# fish completion for PROGRAM
+# PROGRAM completion fish | source
+function FUNC
+    set -l args (commandline -opc)
+    set -e args[1]
+    set -a args "$(commandline -ct)"
+    set -l out (PROGRAM COMPLETE $args 2>/dev/null)
+    switch "$out[1]"
+        case ':delegate *'
+            set -l idx (string split ' ' -- $out[1])
+            set -l words
+            # seq counts down on BSD if the range is empty
+            if test $idx[3] -gt $idx[2]
+                for i in (seq (math $idx[2] + 1) $idx[3])
+                    set -a words $args[$i]
+                end
+            end
+            for i in (seq (math $idx[4] + 1) (count $args))
+                set -a words $args[$i]
+            end
+            set -l cur $words[-1]
+            set -e words[-1]
+            complete -C (string join ' ' -- (string escape -- $words) $cur)
+        case ':file'
+            __fish_complete_path (commandline -ct)
+        case '*'
+            printf '%s\n' $out
+    end
+end
+complete -c PROGRAM -f -a '(FUNC)'
+`
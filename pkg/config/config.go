@@ -6,7 +6,10 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"time"
 
+	"github.com/berquerant/cmdcomp/pkg/cache"
 	"github.com/berquerant/cmdcomp/pkg/slicex"
 )
 
@@ -32,7 +35,11 @@ func NewConfig(
 }
 
 type Config struct {
-	ShowCmdLog  bool
+	ShowCmdLog bool
+	// CmdLogFile is the file to write the command logs as JSON lines.
+	CmdLogFile string
+	// TraceFile is the file to write the command logs as Chrome trace events.
+	TraceFile   string
 	Debug       bool
 	Interceptor []string
 	Preprocess  []string
@@ -41,6 +48,101 @@ type Config struct {
 	Shell       string
 	Delimiter   string
 	UseLabel    bool
+	// LabelFormat is the template of the labels; implies UseLabel.
+	LabelFormat string
+	// LeftLabel is the template of the left label, prior to LabelFormat; implies UseLabel.
+	LeftLabel string
+	// RightLabel is the template of the right label, prior to LabelFormat; implies UseLabel.
+	RightLabel string
+	// Template enables the template expansion of the args, preprocess and diff.
+	Template bool
+	// Vars are the user-defined template variables like 'key=left,right'.
+	// Any vars enable the template expansion.
+	Vars []string
+	// Sweep is the name of the variable to be swept.
+	// Sweep mode renders COMMON_ARGS once for each value and compares them.
+	Sweep string
+	// SweepValues are the values of the Sweep variable.
+	SweepValues []string
+	// SweepFile is the file containing the values of the Sweep variable, one per line.
+	SweepFile string
+	// SweepAgainst is "adjacent" to compare each adjacent pair
+	// or "first" to compare each value against the first.
+	SweepAgainst string
+	// Cache enables the output cache of the commands.
+	Cache bool
+	// CacheDir is the directory of the output cache.
+	CacheDir string
+	// CacheEnv are the names of the environment variables to be included in the cache key.
+	CacheEnv []string
+	// CacheFiles are the files whose hashes are included in the cache key.
+	CacheFiles []string
+	// Timeout is the timeout of each command; 0 means no timeout.
+	Timeout time.Duration
+	// Deadline is the timeout of the whole comparison; 0 means no deadline.
+	Deadline time.Duration
+	// GracePeriod is the duration between SIGTERM and SIGKILL
+	// sent to the canceled commands, the whole process groups of the commands of the sides and preprocess.
+	GracePeriod time.Duration
+	// Retry is the number of the retries of the commands.
+	Retry int
+	// RetryPreprocess is the number of the retries of the preprocess pipelines.
+	RetryPreprocess int
+	// RetryInterceptor is the number of the retries of each interceptor.
+	RetryInterceptor int
+	// RetryBackoff is the wait before the first retry, doubled for each retry.
+	RetryBackoff time.Duration
+	// Bench is the number of the runs of each command to compare the performance.
+	Bench int
+	// BenchOnly skips the diff of the outputs.
+	BenchOnly bool
+	// DryRun prints the commands to be executed without executing them.
+	// "text" or "json".
+	DryRun string
+	// DiffExec executes the diff command split into words by cmdcomp, without Shell.
+	DiffExec bool
+	// MaxOutput is the max bytes of the output of each command and preprocess pipeline; 0 means no limit.
+	MaxOutput int64
+	// TruncateOutput truncates the output exceeding MaxOutput instead of failing.
+	TruncateOutput bool
+	// Binary is how to compare the binary outputs.
+	// "checksum", "hexdump" or "text".
+	Binary string
+	// Brief compares the hashes of the outputs without the diff command.
+	// "text", "json" or "quiet".
+	Brief string
+	// Watch are the files and the directories to be watched.
+	// Watch mode reruns the comparison on every change of them.
+	Watch []string
+	// WatchInclude are the glob patterns of the names of the files to be watched.
+	WatchInclude []string
+	// WatchExclude are the glob patterns of the names of the files not to be watched.
+	WatchExclude []string
+	// WatchInterval is the interval of the polling of the watched files.
+	WatchInterval time.Duration
+	// WatchDebounce is the wait for the changes to settle before rerunning.
+	WatchDebounce time.Duration
+	// InterceptorUndo are the undo commands of the interceptors at the same positions; empty means no undo.
+	// The undo commands of the succeeded interceptors run in reverse order
+	// after the right command, on error or on interrupt.
+	InterceptorUndo []string
+	// LeftIsolated are the indexes of the interceptors not affecting the left command.
+	// They run concurrently with the left command.
+	LeftIsolated []int
+	// GraphFile is the JSON file of the stage graph replacing the default pipeline:
+	// generate, preprocess and diff.
+	GraphFile string
+	// Hooks are the commands like 'PHASE=COMMAND' run at the phases:
+	// setup, beforeLeft, afterRight and teardown.
+	Hooks []string
+	// TUI browses the diff interactively if the Writer is a terminal.
+	TUI bool
+	// FailOn is the results cmdcomp fails on.
+	// "diff", "error" or "never".
+	FailOn string
+	// Stream pipes the outputs of the commands into the preprocess directly,
+	// without writing them to the temporary files.
+	Stream bool
 
 	CommonArgs []string
 	LeftArgs   []string
@@ -48,20 +150,100 @@ type Config struct {
 
 	Writer  io.Writer `json:"-"`
 	TempDir string
+
+	resolved *resolved
+	graph    *Graph
 }
 
-func (c *Config) Init(args []string) error {
+func (c *Config) Init(args []string) (retErr error) {
 	if err := c.setTempDir(); err != nil {
 		return err
 	}
+	defer func() {
+		// Main does not run to close the invalid config
+		if retErr != nil {
+			_ = c.Close()
+		}
+	}()
 	if err := c.setArgs(args); err != nil {
 		return err
 	}
+	if err := c.setSweep(); err != nil {
+		return err
+	}
+	if err := c.setCacheDir(); err != nil {
+		return err
+	}
+	if err := c.validateBench(); err != nil {
+		return err
+	}
+	if err := c.validateDryRun(); err != nil {
+		return err
+	}
+	if err := c.validateStream(); err != nil {
+		return err
+	}
+	if err := c.validateCache(); err != nil {
+		return err
+	}
+	if err := c.validateOutput(); err != nil {
+		return err
+	}
+	if err := c.validateBrief(); err != nil {
+		return err
+	}
+	if err := c.validateWatch(); err != nil {
+		return err
+	}
+	if err := c.validateTUI(); err != nil {
+		return err
+	}
+	if err := c.validateFailOn(); err != nil {
+		return err
+	}
+	if err := c.validateHooks(); err != nil {
+		return err
+	}
+	if err := c.setGraph(); err != nil {
+		return err
+	}
+	if len(c.InterceptorUndo) > len(c.Interceptor) {
+		return fmt.Errorf("%w: more undo than interceptors", ErrConfig)
+	}
+	for _, i := range c.LeftIsolated {
+		if i < 0 || i >= len(c.Interceptor) {
+			return fmt.Errorf("%w: leftIsolated %d out of interceptors", ErrConfig, i)
+		}
+	}
+	if err := c.resolve(); err != nil {
+		return err
+	}
+	if c.DiffExec {
+		if _, err := c.GetDiffArgs(); err != nil {
+			return err
+		}
+	}
+	if err := c.setLabel(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// GetInterceptorIndexes returns the indexes of the left-isolated interceptors and the others.
+func (c Config) GetInterceptorIndexes() ([]int, []int) {
+	var isolated, others []int
+	for i := range c.Interceptor {
+		if slices.Contains(c.LeftIsolated, i) {
+			isolated = append(isolated, i)
+		} else {
+			others = append(others, i)
+		}
+	}
+	return isolated, others
+}
+
 func (c *Config) Close() error {
-	if c.WorkDir == "" {
+	if c.WorkDir == "" && c.DryRun == "" {
 		return os.RemoveAll(c.TempDir)
 	}
 	return nil
@@ -72,6 +254,11 @@ func (c *Config) setTempDir() error {
 		c.TempDir = d
 		return nil
 	}
+	if c.DryRun != "" {
+		// dry run creates nothing
+		c.TempDir = DryRunTempDir
+		return nil
+	}
 	d, err := os.MkdirTemp(os.TempDir(), "cmdcomp")
 	if err != nil {
 		return err
@@ -80,12 +267,169 @@ func (c *Config) setTempDir() error {
 	return nil
 }
 
-func (c Config) GetLeftArgs() []string {
-	return append(c.CommonArgs, c.LeftArgs...)
+func (c *Config) setCacheDir() error {
+	if !c.Cache || c.CacheDir != "" {
+		return nil
+	}
+	d, err := cache.DefaultDir()
+	if err != nil {
+		return fmt.Errorf("%w: cache dir: %w", ErrConfig, err)
+	}
+	c.CacheDir = d
+	return nil
+}
+
+const (
+	DryRunText = "text"
+	DryRunJSON = "json"
+	// DryRunTempDir is the placeholder of the temporary directory in the plan.
+	DryRunTempDir = "TEMP_DIR"
+)
+
+func (c Config) validateDryRun() error {
+	switch c.DryRun {
+	case "", DryRunText, DryRunJSON:
+		return nil
+	default:
+		return fmt.Errorf("%w: invalid dry run format %q", ErrConfig, c.DryRun)
+	}
+}
+
+func (c Config) validateBench() error {
+	if c.BenchOnly && c.Bench <= 0 {
+		return fmt.Errorf("%w: benchOnly requires bench", ErrConfig)
+	}
+	if c.Bench > 0 && c.Sweep != "" {
+		return fmt.Errorf("%w: bench does not support sweep", ErrConfig)
+	}
+	return nil
+}
+
+const (
+	// BinaryChecksum compares the checksums of the binary outputs.
+	BinaryChecksum = "checksum"
+	// BinaryHexdump passes the hexdumps of the binary outputs to the diff command.
+	BinaryHexdump = "hexdump"
+	// BinaryText passes the binary outputs to the diff command as they are.
+	BinaryText = "text"
+)
+
+func (c *Config) validateOutput() error {
+	if c.MaxOutput < 0 {
+		return fmt.Errorf("%w: negative maxOutput", ErrConfig)
+	}
+	if c.TruncateOutput && c.MaxOutput == 0 {
+		return fmt.Errorf("%w: truncateOutput requires maxOutput", ErrConfig)
+	}
+	switch c.Binary {
+	case "":
+		c.Binary = BinaryChecksum
+		return nil
+	case BinaryChecksum, BinaryHexdump, BinaryText:
+		return nil
+	default:
+		return fmt.Errorf("%w: invalid binary %q", ErrConfig, c.Binary)
+	}
+}
+
+const (
+	// FailOnDiff fails on the diffs and the errors.
+	FailOnDiff = "diff"
+	// FailOnError fails only on the errors.
+	FailOnError = "error"
+	// FailOnNever always succeeds.
+	FailOnNever = "never"
+)
+
+func (c *Config) validateFailOn() error {
+	switch c.FailOn {
+	case "":
+		c.FailOn = FailOnDiff
+		return nil
+	case FailOnDiff, FailOnError, FailOnNever:
+		return nil
+	default:
+		return fmt.Errorf("%w: invalid failOn %q", ErrConfig, c.FailOn)
+	}
+}
+
+const (
+	// BriefText prints a line only if the outputs differ.
+	BriefText = "text"
+	// BriefJSON prints the hashes and the sizes of the outputs as a JSON line.
+	BriefJSON = "json"
+	// BriefQuiet prints nothing.
+	BriefQuiet = "quiet"
+)
+
+func (c Config) validateBrief() error {
+	switch c.Brief {
+	case "", BriefText, BriefJSON, BriefQuiet:
+		return nil
+	default:
+		return fmt.Errorf("%w: invalid brief %q", ErrConfig, c.Brief)
+	}
 }
 
-func (c Config) GetRightArgs() []string {
-	return append(c.CommonArgs, c.RightArgs...)
+func (c Config) validateWatch() error {
+	if len(c.Watch) == 0 {
+		return nil
+	}
+	if c.Sweep != "" {
+		return fmt.Errorf("%w: watch does not support sweep", ErrConfig)
+	}
+	if c.Bench > 0 {
+		return fmt.Errorf("%w: watch does not support bench", ErrConfig)
+	}
+	if c.WatchInterval <= 0 {
+		return fmt.Errorf("%w: watchInterval should be positive", ErrConfig)
+	}
+	return nil
+}
+
+func (c Config) validateTUI() error {
+	if !c.TUI {
+		return nil
+	}
+	switch {
+	case c.Sweep != "":
+		return fmt.Errorf("%w: tui does not support sweep", ErrConfig)
+	case len(c.Watch) > 0:
+		return fmt.Errorf("%w: tui does not support watch", ErrConfig)
+	case c.Brief != "":
+		return fmt.Errorf("%w: tui does not support brief", ErrConfig)
+	}
+	return nil
+}
+
+func (c Config) validateStream() error {
+	if !c.Stream {
+		return nil
+	}
+	if c.Cache {
+		return fmt.Errorf("%w: stream does not support cache", ErrConfig)
+	}
+	if c.Bench > 0 {
+		return fmt.Errorf("%w: stream does not support bench", ErrConfig)
+	}
+	return nil
+}
+
+// validateCache rejects the commands changing the world between the sides,
+// since the key of the right side can be the same as the left and replay the output of the left.
+func (c Config) validateCache() error {
+	if !c.Cache {
+		return nil
+	}
+	switch {
+	case len(c.Interceptor) > 0:
+		return fmt.Errorf("%w: cache does not support interceptors", ErrConfig)
+	case len(c.InterceptorUndo) > 0:
+		return fmt.Errorf("%w: cache does not support undo", ErrConfig)
+	case len(c.GetHooks(HookBeforeLeft)) > 0 || len(c.GetHooks(HookAfterRight)) > 0:
+		return fmt.Errorf("%w: cache does not support %s and %s hooks", ErrConfig, HookBeforeLeft, HookAfterRight)
+	}
+	return nil
 }
 
 func (c *Config) setArgs(args []string) error {
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/berquerant/cmdcomp/pkg/graph"
+)
+
+// Kinds of the stages of the graph.
+//
+// The outputs of the sources and the transforms are files,
+// the output of a differ is "same" or "differ" and a hook has no output.
+const (
+	// StageSource runs the command of the side or Args and outputs its stdout.
+	StageSource = "source"
+	// StageTransform pipes the input into Commands like preprocess.
+	StageTransform = "transform"
+	// StageHook runs Commands without inputs and outputs.
+	StageHook = "hook"
+	// StageDiffer compares the 2 inputs by the diff command.
+	StageDiffer = "differ"
+	// StageReporter runs Commands with the inputs as the positional arguments and writes their stdout.
+	StageReporter = "reporter"
+)
+
+// GraphStage is a stage of the graph file.
+type GraphStage struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Side is left or right; the args of the side are the command of the source.
+	Side string `json:"side,omitempty"`
+	// Args is the command of the source instead of Side.
+	Args     []string `json:"args,omitempty"`
+	Commands []string `json:"commands,omitempty"`
+	Inputs   []string `json:"inputs,omitempty"`
+	After    []string `json:"after,omitempty"`
+}
+
+// Graph is the content of the graph file.
+type Graph struct {
+	Stages []*GraphStage `json:"stages"`
+}
+
+// GetGraph returns the graph read from GraphFile, or nil if no graph file.
+func (c Config) GetGraph() *Graph {
+	return c.graph
+}
+
+func (c *Config) setGraph() error {
+	if c.GraphFile == "" {
+		return nil
+	}
+	switch {
+	case c.Sweep != "":
+		return fmt.Errorf("%w: graph does not support sweep", ErrConfig)
+	case c.Bench > 0:
+		return fmt.Errorf("%w: graph does not support bench", ErrConfig)
+	case len(c.Watch) > 0:
+		return fmt.Errorf("%w: graph does not support watch", ErrConfig)
+	case c.TUI:
+		return fmt.Errorf("%w: graph does not support tui", ErrConfig)
+	case c.Stream:
+		return fmt.Errorf("%w: graph does not support stream", ErrConfig)
+	case len(c.Interceptor) > 0:
+		return fmt.Errorf("%w: graph does not support interceptors, use hook stages", ErrConfig)
+	case len(c.GetHooks(HookBeforeLeft)) > 0 || len(c.GetHooks(HookAfterRight)) > 0:
+		return fmt.Errorf("%w: graph does not support %s and %s hooks, use hook stages", ErrConfig, HookBeforeLeft, HookAfterRight)
+	}
+
+	b, err := os.ReadFile(c.GraphFile)
+	if err != nil {
+		return fmt.Errorf("%w: read graph: %w", ErrConfig, err)
+	}
+	var x Graph
+	if err := json.Unmarshal(b, &x); err != nil {
+		return fmt.Errorf("%w: parse graph: %w", ErrConfig, err)
+	}
+	if err := x.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	if c.Cache && slices.ContainsFunc(x.Stages, func(s *GraphStage) bool { return s.Kind == StageHook }) {
+		return fmt.Errorf("%w: cache does not support hook stages", ErrConfig)
+	}
+	c.graph = &x
+	return nil
+}
+
+func (g Graph) validate() error {
+	if len(g.Stages) == 0 {
+		return fmt.Errorf("no stages")
+	}
+	kinds := make(map[string]string, len(g.Stages))
+	for _, s := range g.Stages {
+		kinds[s.Name] = s.Kind
+	}
+	x := graph.New()
+	for _, s := range g.Stages {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if s.Kind == StageTransform || s.Kind == StageDiffer {
+			for _, in := range s.Inputs {
+				// unknown stages are reported by Order
+				if k, ok := kinds[in]; ok && k != StageSource && k != StageTransform {
+					return fmt.Errorf("%s stage %q cannot take the output of %s stage %q", s.Kind, s.Name, k, in)
+				}
+			}
+		}
+		if err := x.Add(&graph.Stage{
+			Name:   s.Name,
+			Inputs: s.Inputs,
+			After:  s.After,
+			Run: func(context.Context, []string) (string, error) {
+				return "", nil
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	_, err := x.Order()
+	return err
+}
+
+func (s GraphStage) validate() error {
+	wantInputs := func(n int) error {
+		if len(s.Inputs) != n {
+			return fmt.Errorf("%s stage %q should have %d inputs", s.Kind, s.Name, n)
+		}
+		return nil
+	}
+	wantCommands := func() error {
+		if len(s.Commands) == 0 {
+			return fmt.Errorf("%s stage %q has no commands", s.Kind, s.Name)
+		}
+		return nil
+	}
+
+	switch s.Kind {
+	case StageSource:
+		if (s.Side == "") == (len(s.Args) == 0) {
+			return fmt.Errorf("source stage %q should have either side or args", s.Name)
+		}
+		if s.Side != "" && s.Side != "left" && s.Side != "right" {
+			return fmt.Errorf("source stage %q has invalid side %q", s.Name, s.Side)
+		}
+		return wantInputs(0)
+	case StageTransform:
+		if err := wantCommands(); err != nil {
+			return err
+		}
+		return wantInputs(1)
+	case StageHook:
+		if err := wantCommands(); err != nil {
+			return err
+		}
+		return wantInputs(0)
+	case StageDiffer:
+		return wantInputs(2)
+	case StageReporter:
+		return wantCommands()
+	default:
+		return fmt.Errorf("stage %q has unknown kind %q", s.Name, s.Kind)
+	}
+}
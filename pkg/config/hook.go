@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Hook phases.
+const (
+	// HookSetup runs before everything.
+	HookSetup = "setup"
+	// HookBeforeLeft runs before the left command.
+	HookBeforeLeft = "beforeLeft"
+	// HookAfterRight runs after the right command.
+	HookAfterRight = "afterRight"
+	// HookTeardown runs after everything, even on failure or interrupt.
+	HookTeardown = "teardown"
+)
+
+// HookPhases are the hook phases in the order of execution.
+var HookPhases = []string{
+	HookSetup,
+	HookBeforeLeft,
+	HookAfterRight,
+	HookTeardown,
+}
+
+// GetHooks returns the commands of the hook phase.
+func (c Config) GetHooks(phase string) []string {
+	var xs []string
+	for _, h := range c.Hooks {
+		if p, cmd, _ := strings.Cut(h, "="); p == phase {
+			xs = append(xs, cmd)
+		}
+	}
+	return xs
+}
+
+func (c Config) validateHooks() error {
+	for _, h := range c.Hooks {
+		phase, cmd, ok := strings.Cut(h, "=")
+		if !ok || cmd == "" {
+			return fmt.Errorf("%w: invalid hook %q, should be PHASE=COMMAND", ErrConfig, h)
+		}
+		if !slices.Contains(HookPhases, phase) {
+			return fmt.Errorf("%w: unknown hook phase %q", ErrConfig, phase)
+		}
+	}
+	if len(c.GetHooks(HookBeforeLeft)) == 0 && len(c.GetHooks(HookAfterRight)) == 0 {
+		return nil
+	}
+	if c.Sweep != "" {
+		return fmt.Errorf("%w: sweep does not support %s and %s hooks", ErrConfig, HookBeforeLeft, HookAfterRight)
+	}
+	if c.Bench > 0 {
+		return fmt.Errorf("%w: bench does not support %s and %s hooks", ErrConfig, HookBeforeLeft, HookAfterRight)
+	}
+	return nil
+}
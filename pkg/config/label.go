@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/berquerant/cmdcomp/pkg/tmpl"
+)
+
+func (c Config) useCustomLabel() bool {
+	return c.LabelFormat != "" || c.LeftLabel != "" || c.RightLabel != ""
+}
+
+// GetLabels returns the labels of the sides compared in the diff.
+// Returns false if the labels are not customized.
+func (c Config) GetLabels(left, right Side) (string, string, bool, error) {
+	if !c.useCustomLabel() {
+		return "", "", false, nil
+	}
+	l, err := c.executeLabel(c.LeftLabel, "left", left)
+	if err != nil {
+		return "", "", false, err
+	}
+	r, err := c.executeLabel(c.RightLabel, "right", right)
+	if err != nil {
+		return "", "", false, err
+	}
+	return l, r, true, nil
+}
+
+func (c Config) executeLabel(text, position string, side Side) (string, error) {
+	if text == "" {
+		text = c.LabelFormat
+	}
+	if text == "" {
+		// only the other side is customized
+		text = "{{.Args | shellquote}}"
+	}
+	x, err := tmpl.Execute(text, tmpl.LabelData{
+		Side:  position,
+		Name:  side.Name,
+		Index: side.Index,
+		Args:  side.Args,
+		Vars:  side.Vars,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s label", err, position)
+	}
+	return x, nil
+}
+
+func (c *Config) setLabel() error {
+	if !c.useCustomLabel() {
+		return nil
+	}
+	c.UseLabel = true
+	// validate the templates
+	left, right := c.GetLeft(), c.GetRight()
+	if xs := c.GetSweep(); len(xs) > 1 {
+		left, right = xs[0], xs[1]
+	}
+	_, _, _, err := c.GetLabels(left, right)
+	return err
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/berquerant/cmdcomp/pkg/shell"
+	"github.com/berquerant/cmdcomp/pkg/tmpl"
+)
+
+// Side is the commands producing one of the outputs to be compared.
+type Side struct {
+	// Name is "left", "right" or the value of the sweep variable.
+	Name       string
+	Index      int
+	Args       []string
+	Preprocess []string
+	// Vars are the template variables of the side.
+	Vars map[string]string
+}
+
+// The args, preprocess and diff after the template expansion.
+type resolved struct {
+	left  Side
+	right Side
+	sweep []Side
+	diff  string
+}
+
+func (c Config) GetLeftArgs() []string {
+	return c.GetLeft().Args
+}
+
+func (c Config) GetRightArgs() []string {
+	return c.GetRight().Args
+}
+
+func (c Config) GetLeft() Side {
+	if c.resolved != nil {
+		return c.resolved.left
+	}
+	return Side{
+		Name:       "left",
+		Index:      0,
+		Args:       append(c.CommonArgs, c.LeftArgs...),
+		Preprocess: c.Preprocess,
+	}
+}
+
+func (c Config) GetRight() Side {
+	if c.resolved != nil {
+		return c.resolved.right
+	}
+	return Side{
+		Name:       "right",
+		Index:      1,
+		Args:       append(c.CommonArgs, c.RightArgs...),
+		Preprocess: c.Preprocess,
+	}
+}
+
+// GetSweep returns the sides of the sweep values.
+func (c Config) GetSweep() []Side {
+	if c.resolved != nil {
+		return c.resolved.sweep
+	}
+	return nil
+}
+
+func (c Config) GetDiff() string {
+	if c.resolved != nil {
+		return c.resolved.diff
+	}
+	return c.Diff
+}
+
+// GetDiffArgs returns the diff command split into words.
+func (c Config) GetDiffArgs() ([]string, error) {
+	xs, err := shell.Split(c.GetDiff())
+	if err != nil {
+		return nil, fmt.Errorf("%w: diff: %w", ErrConfig, err)
+	}
+	if len(xs) == 0 {
+		return nil, fmt.Errorf("%w: empty diff", ErrConfig)
+	}
+	return xs, nil
+}
+
+func (c Config) useTemplate() bool {
+	return c.Template || len(c.Vars) > 0 || c.Sweep != ""
+}
+
+// ParseVars parses the vars like 'key=left,right' into the left and the right values.
+func ParseVars(vars []string) (map[string]string, map[string]string, error) {
+	var (
+		left  = map[string]string{}
+		right = map[string]string{}
+	)
+	for _, v := range vars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, nil, fmt.Errorf("%w: invalid var %q, should be key=left,right", ErrConfig, v)
+		}
+		l, r, ok := strings.Cut(value, ",")
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: invalid var %q, should be key=left,right", ErrConfig, v)
+		}
+		left[key] = l
+		right[key] = r
+	}
+	return left, right, nil
+}
+
+func (c Config) resolveSide(name string, args []string, data tmpl.Data) (Side, error) {
+	var (
+		side = Side{Name: name, Index: data.Index, Vars: data.Vars}
+		err  error
+	)
+	if side.Args, err = tmpl.ExecuteAll(args, data); err != nil {
+		return side, fmt.Errorf("%w: %s args", err, data.Side)
+	}
+	if side.Preprocess, err = tmpl.ExecuteAll(c.Preprocess, data); err != nil {
+		return side, fmt.Errorf("%w: %s preprocess", err, data.Side)
+	}
+	return side, nil
+}
+
+func (c *Config) resolve() error {
+	if !c.useTemplate() {
+		return nil
+	}
+
+	leftVars, rightVars, err := ParseVars(c.Vars)
+	if err != nil {
+		return err
+	}
+	var (
+		r     resolved
+		left  = tmpl.Data{Side: "left", Index: 0, TempDir: c.TempDir, Vars: leftVars}
+		right = tmpl.Data{Side: "right", Index: 1, TempDir: c.TempDir, Vars: rightVars}
+		diff  = tmpl.Data{Side: "diff", Index: -1, TempDir: c.TempDir}
+	)
+	if c.Sweep != "" {
+		r.sweep = make([]Side, len(c.SweepValues))
+		for i, v := range c.SweepValues {
+			vars := maps.Clone(leftVars)
+			vars[c.Sweep] = v
+			data := tmpl.Data{Side: "sweep", Index: i, TempDir: c.TempDir, Vars: vars}
+			if r.sweep[i], err = c.resolveSide(v, c.CommonArgs, data); err != nil {
+				return err
+			}
+		}
+	} else {
+		if r.left, err = c.resolveSide("left", append(c.CommonArgs, c.LeftArgs...), left); err != nil {
+			return err
+		}
+		if r.right, err = c.resolveSide("right", append(c.CommonArgs, c.RightArgs...), right); err != nil {
+			return err
+		}
+	}
+	if r.diff, err = tmpl.Execute(c.Diff, diff); err != nil {
+		return fmt.Errorf("%w: diff", err)
+	}
+	c.resolved = &r
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	SweepAdjacent = "adjacent"
+	SweepFirst    = "first"
+)
+
+// SweepPair is a pair of the indexes of the sweep values to be compared.
+type SweepPair struct {
+	Left  int
+	Right int
+}
+
+// GetSweepPairs returns the pairs of the sweep values to be compared.
+func (c Config) GetSweepPairs() []SweepPair {
+	xs := []SweepPair{}
+	for i := 1; i < len(c.SweepValues); i++ {
+		if c.SweepAgainst == SweepFirst {
+			xs = append(xs, SweepPair{Left: 0, Right: i})
+		} else {
+			xs = append(xs, SweepPair{Left: i - 1, Right: i})
+		}
+	}
+	return xs
+}
+
+func (c *Config) setSweep() error {
+	if c.Sweep == "" {
+		return nil
+	}
+	if len(c.LeftArgs) > 0 || len(c.RightArgs) > 0 {
+		return fmt.Errorf("%w: sweep accepts only COMMON_ARGS", ErrConfig)
+	}
+	if len(c.Interceptor) > 0 {
+		return fmt.Errorf("%w: sweep does not support interceptors", ErrConfig)
+	}
+	switch c.SweepAgainst {
+	case "":
+		c.SweepAgainst = SweepAdjacent
+	case SweepAdjacent, SweepFirst:
+	default:
+		return fmt.Errorf("%w: invalid sweep against %q", ErrConfig, c.SweepAgainst)
+	}
+	if c.SweepFile != "" {
+		xs, err := readSweepFile(c.SweepFile)
+		if err != nil {
+			return fmt.Errorf("%w: read sweep file: %w", ErrConfig, err)
+		}
+		c.SweepValues = append(c.SweepValues, xs...)
+	}
+	if len(c.SweepValues) < 2 {
+		return fmt.Errorf("%w: sweep requires at least 2 values", ErrConfig)
+	}
+	return nil
+}
+
+// readSweepFile reads the values from the file, skipping blank lines.
+func readSweepFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	xs := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if x := strings.TrimSpace(scanner.Text()); x != "" {
+			xs = append(xs, x)
+		}
+	}
+	return xs, scanner.Err()
+}
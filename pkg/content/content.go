@@ -0,0 +1,105 @@
+package content
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// sniffLen is the number of the bytes to be inspected to detect binary content, like git.
+const sniffLen = 8000
+
+// IsBinary returns true if the file contains a NUL byte in its first bytes.
+func IsBinary(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	b := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.IndexByte(b[:n], 0) >= 0, nil
+}
+
+// Sum is the checksum of a file.
+type Sum struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+func (s Sum) String() string {
+	return fmt.Sprintf("sha256:%s %d bytes", s.SHA256, s.Size)
+}
+
+// Checksum returns the sha256 and the size of the file.
+func Checksum(path string) (*Sum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return &Sum{
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Size:   n,
+	}, nil
+}
+
+const hexdumpWidth = 16
+
+// Hexdump writes the content of r like 'xxd', 16 bytes per line.
+func Hexdump(w io.Writer, r io.Reader) error {
+	var (
+		buf    = make([]byte, hexdumpWidth)
+		offset int
+	)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := io.WriteString(w, hexdumpLine(offset, buf[:n])); err != nil {
+				return err
+			}
+			offset += n
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func hexdumpLine(offset int, b []byte) string {
+	var s bytes.Buffer
+	_, _ = fmt.Fprintf(&s, "%08x:", offset)
+	for i := range hexdumpWidth {
+		if i%2 == 0 {
+			s.WriteByte(' ')
+		}
+		if i < len(b) {
+			_, _ = fmt.Fprintf(&s, "%02x", b[i])
+		} else {
+			s.WriteString("  ")
+		}
+	}
+	s.WriteString("  ")
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		s.WriteByte(c)
+	}
+	s.WriteByte('\n')
+	return s.String()
+}
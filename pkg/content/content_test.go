@@ -0,0 +1,66 @@
+package content_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/berquerant/cmdcomp/pkg/content"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBinary(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		title string
+		data  string
+		want  bool
+	}{
+		{
+			title: "empty",
+			data:  "",
+		},
+		{
+			title: "text",
+			data:  "a\nb\n",
+		},
+		{
+			title: "nul",
+			data:  "a\x00b",
+			want:  true,
+		},
+		{
+			title: "nul after sniff",
+			data:  strings.Repeat("a", 8000) + "\x00",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			path := filepath.Join(dir, tc.title)
+			assert.Nil(t, os.WriteFile(path, []byte(tc.data), 0o644))
+			got, err := content.IsBinary(path)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	assert.Nil(t, os.WriteFile(path, []byte("a\n"), 0o644))
+	got, err := content.Checksum(path)
+	assert.Nil(t, err)
+	assert.Equal(t, &content.Sum{
+		SHA256: "87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7",
+		Size:   2,
+	}, got)
+}
+
+func TestHexdump(t *testing.T) {
+	var got bytes.Buffer
+	assert.Nil(t, content.Hexdump(&got, strings.NewReader("ab\x00cdefghijklmnopqrs")))
+	assert.Equal(t, `00000000: 6162 0063 6465 6667 6869 6a6b 6c6d 6e6f  ab.cdefghijklmno
+00000010: 7071 7273                                pqrs
+`, got.String())
+}
@@ -0,0 +1,329 @@
+// Package defaults fills the flags not given on the command line
+// from the environment variables and the config files.
+//
+// The precedence is: flag > profile > env > project file > user file > built-in default.
+package defaults
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/spf13/pflag"
+)
+
+var ErrDefaults = errors.New("Defaults")
+
+const (
+	// EnvPrefix is the prefix of the environment variables of the flags.
+	EnvPrefix = "CMDCOMP_"
+	// ProjectFileName is the name of the project config file,
+	// searched from the current directory up to the root.
+	ProjectFileName = ".cmdcomp.json"
+)
+
+// trustedProjectsKey is the key of the user file listing the directories of the project files to be read,
+// since the project files can run the commands like --interceptor.
+const trustedProjectsKey = "trustedProjects"
+
+// Origins of the values of the flags.
+const (
+	OriginFlag    = "flag"
+	OriginProfile = "profile"
+	OriginEnv     = "env"
+	OriginProject = "project"
+	OriginUser    = "user"
+	OriginDefault = "default"
+)
+
+// EnvName returns the name of the environment variable of the flag,
+// e.g. CMDCOMP_LABEL_FORMAT for labelFormat.
+func EnvName(flag string) string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	for i, r := range flag {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// UserFile returns the path of the user config file under the XDG config directory.
+func UserFile() (string, error) {
+	d := os.Getenv("XDG_CONFIG_HOME")
+	if d == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		d = filepath.Join(home, ".config")
+	}
+	return filepath.Join(d, "cmdcomp", "config.json"), nil
+}
+
+// FindProjectFile returns the path of the nearest project config file from dir,
+// or empty if not found.
+func FindProjectFile(dir string) string {
+	for {
+		p := filepath.Join(dir, ProjectFileName)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Source is a set of the values of the flags.
+type Source struct {
+	// Origin is one of profile, env, project and user.
+	Origin string
+	// Path is the config file, empty for env.
+	Path string
+	// Values are the values of the flags by names; the repeatable flags may have many values.
+	Values map[string][]string
+	// Profiles are the profiles defined in the config file.
+	Profiles Profiles
+	// TrustedProjects are the directories of the trusted project files, only in the user file.
+	TrustedProjects []string
+	// names are the names of the values in the source, e.g. the environment variables.
+	names map[string]string
+}
+
+// Trusts returns true if the project file is in the trusted directories of the user file.
+func (s *Source) Trusts(projectFile string) bool {
+	if s == nil {
+		return false
+	}
+	dir := filepath.Dir(projectFile)
+	for _, x := range s.TrustedProjects {
+		if filepath.Clean(x) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the origin with the name of the value of the flag.
+func (s Source) String(flag string) string {
+	if s.Path != "" {
+		return fmt.Sprintf("%s %s", s.Origin, s.Path)
+	}
+	if name, ok := s.names[flag]; ok {
+		return fmt.Sprintf("%s %s", s.Origin, name)
+	}
+	return s.Origin
+}
+
+// NewEnvSource reads the environment variables of the flags.
+// The values of the repeatable flags are separated by newlines.
+func NewEnvSource(fs *pflag.FlagSet) *Source {
+	s := &Source{
+		Origin: OriginEnv,
+		Values: map[string][]string{},
+		names:  map[string]string{},
+	}
+	fs.VisitAll(func(f *pflag.Flag) {
+		name := EnvName(f.Name)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if isRepeatable(f) {
+			s.Values[f.Name] = strings.Split(v, "\n")
+		} else {
+			s.Values[f.Name] = []string{v}
+		}
+		s.names[f.Name] = name
+	})
+	return s
+}
+
+func isRepeatable(f *pflag.Flag) bool {
+	t := f.Value.Type()
+	return strings.HasSuffix(t, "Array") || strings.HasSuffix(t, "Slice")
+}
+
+// ReadFile reads the config file, a JSON object whose keys are the names of the flags.
+// The values are strings, numbers, booleans or arrays of them for the repeatable flags.
+// The key "profiles" is the object of the profiles whose values are objects like the config file.
+// The key "trustedProjects" of the user file is the array of the absolute directories of the trusted project files.
+// Returns nil if the file does not exist.
+func ReadFile(origin, path string) (*Source, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: read %s: %w", ErrDefaults, path, err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%w: parse %s: %w", ErrDefaults, path, err)
+	}
+	s := &Source{
+		Origin: origin,
+		Path:   path,
+		Values: make(map[string][]string, len(m)),
+	}
+	for k, v := range m {
+		if k == trustedProjectsKey {
+			xs, err := trustedProjects(origin, v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrDefaults, path, err)
+			}
+			s.TrustedProjects = xs
+			continue
+		}
+		if k == profilesKey {
+			ps, err := fileProfiles(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrDefaults, path, err)
+			}
+			s.Profiles = ps
+			continue
+		}
+		xs, err := fileValues(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s: %w", ErrDefaults, path, k, err)
+		}
+		s.Values[k] = xs
+	}
+	return s, nil
+}
+
+func trustedProjects(origin string, v any) ([]string, error) {
+	if origin != OriginUser {
+		return nil, fmt.Errorf("%s is available only in the user file", trustedProjectsKey)
+	}
+	xs, err := fileValues(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", trustedProjectsKey, err)
+	}
+	for _, x := range xs {
+		if !filepath.IsAbs(x) {
+			return nil, fmt.Errorf("%s: %q should be absolute", trustedProjectsKey, x)
+		}
+	}
+	return xs, nil
+}
+
+func fileProfiles(v any) (Profiles, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s should be an object", profilesKey)
+	}
+	ps := make(Profiles, len(m))
+	for name, x := range m {
+		values, ok := x.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("profile %s should be an object", name)
+		}
+		p := make(Profile, len(values))
+		for k, v := range values {
+			xs, err := fileValues(v)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %s: %w", name, k, err)
+			}
+			p[k] = xs
+		}
+		ps[name] = p
+	}
+	return ps, nil
+}
+
+func fileValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case []any:
+		xs := make([]string, len(v))
+		for i, x := range v {
+			y, err := fileValue(x)
+			if err != nil {
+				return nil, err
+			}
+			xs[i] = y
+		}
+		return xs, nil
+	default:
+		x, err := fileValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{x}, nil
+	}
+}
+
+func fileValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// Origins are the origins of the values of the flags by names.
+type Origins map[string]string
+
+// Apply sets the flags not given on the command line from the sources in order of precedence.
+func Apply(fs *pflag.FlagSet, sources ...*Source) (Origins, error) {
+	origins := Origins{}
+	fs.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			origins[f.Name] = OriginFlag
+		} else {
+			origins[f.Name] = OriginDefault
+		}
+	})
+
+	for _, s := range sources {
+		if s == nil {
+			continue
+		}
+		for name, values := range s.Values {
+			f := fs.Lookup(name)
+			if f == nil {
+				if s.Path != "" {
+					return nil, fmt.Errorf("%w: unknown flag %q in %s", ErrDefaults, name, s.Path)
+				}
+				continue
+			}
+			if origins[name] != OriginDefault {
+				continue
+			}
+			if !isRepeatable(f) && len(values) != 1 {
+				return nil, fmt.Errorf("%w: %s: %s should have a value", ErrDefaults, s.String(name), name)
+			}
+			for _, v := range values {
+				if err := fs.Set(name, v); err != nil {
+					return nil, fmt.Errorf("%w: %s: %w", ErrDefaults, s.String(name), err)
+				}
+			}
+			origins[name] = s.String(name)
+		}
+	}
+	return origins, nil
+}
+
+// Show writes the effective values of the flags and their origins.
+func Show(w io.Writer, fs *pflag.FlagSet, origins Origins) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FLAG\tVALUE\tORIGIN")
+	fs.VisitAll(func(f *pflag.Flag) {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Name, f.Value.String(), origins[f.Name])
+	})
+	return tw.Flush()
+}
@@ -0,0 +1,258 @@
+package defaults_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/cmdcomp/pkg/defaults"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvName(t *testing.T) {
+	for flag, want := range map[string]string{
+		"diff":        "CMDCOMP_DIFF",
+		"labelFormat": "CMDCOMP_LABEL_FORMAT",
+		"dryRun":      "CMDCOMP_DRY_RUN",
+	} {
+		assert.Equal(t, want, defaults.EnvName(flag))
+	}
+}
+
+func TestFindProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "a", "b")
+	assert.Nil(t, os.MkdirAll(sub, 0o755))
+	assert.Equal(t, "", defaults.FindProjectFile(sub))
+	p := filepath.Join(dir, "a", defaults.ProjectFileName)
+	assert.Nil(t, os.WriteFile(p, []byte("{}"), 0o600))
+	assert.Equal(t, p, defaults.FindProjectFile(sub))
+}
+
+func TestApply(t *testing.T) {
+	newFlagSet := func() (*pflag.FlagSet, *string, *string, *bool, *[]string) {
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		var (
+			diff       = fs.String("diff", "diff", "")
+			shell      = fs.String("shell", "bash", "")
+			label      = fs.Bool("label", false, "")
+			preprocess []string
+		)
+		fs.StringArrayVar(&preprocess, "preprocess", nil, "")
+		return fs, diff, shell, label, &preprocess
+	}
+	writeFile := func(t *testing.T, content string) string {
+		t.Helper()
+		p := filepath.Join(t.TempDir(), "config.json")
+		assert.Nil(t, os.WriteFile(p, []byte(content), 0o600))
+		return p
+	}
+
+	t.Run("precedence", func(t *testing.T) {
+		fs, diff, shell, label, preprocess := newFlagSet()
+		assert.Nil(t, fs.Parse([]string{"--shell", "sh"}))
+		t.Setenv("CMDCOMP_SHELL", "zsh")
+		t.Setenv("CMDCOMP_PREPROCESS", "cat\nsort")
+		project, err := defaults.ReadFile(defaults.OriginProject, writeFile(t, `{"diff": "diff -u", "shell": "fish"}`))
+		assert.Nil(t, err)
+		userPath := writeFile(t, `{"diff": "diff -c", "label": true, "preprocess": ["tac"]}`)
+		user, err := defaults.ReadFile(defaults.OriginUser, userPath)
+		assert.Nil(t, err)
+
+		origins, err := defaults.Apply(fs, defaults.NewEnvSource(fs), project, user)
+		assert.Nil(t, err)
+		assert.Equal(t, "sh", *shell)
+		assert.Equal(t, []string{"cat", "sort"}, *preprocess)
+		assert.Equal(t, "diff -u", *diff)
+		assert.True(t, *label)
+		assert.Equal(t, defaults.Origins{
+			"shell":      defaults.OriginFlag,
+			"preprocess": "env CMDCOMP_PREPROCESS",
+			"diff":       "project " + project.Path,
+			"label":      "user " + userPath,
+		}, origins)
+
+		var b bytes.Buffer
+		assert.Nil(t, defaults.Show(&b, fs, origins))
+		assert.Equal(t, `FLAG        VALUE       ORIGIN
+diff        diff -u     project `+project.Path+`
+label       true        user `+userPath+`
+preprocess  [cat,sort]  env CMDCOMP_PREPROCESS
+shell       sh          flag
+`, b.String())
+	})
+
+	t.Run("no file", func(t *testing.T) {
+		s, err := defaults.ReadFile(defaults.OriginUser, filepath.Join(t.TempDir(), "none.json"))
+		assert.Nil(t, err)
+		assert.Nil(t, s)
+		fs, diff, _, _, _ := newFlagSet()
+		origins, err := defaults.Apply(fs, s)
+		assert.Nil(t, err)
+		assert.Equal(t, "diff", *diff)
+		assert.Equal(t, defaults.OriginDefault, origins["diff"])
+	})
+
+	t.Run("trusted projects", func(t *testing.T) {
+		dir := t.TempDir()
+		user, err := defaults.ReadFile(defaults.OriginUser, writeFile(t, fmt.Sprintf(`{"trustedProjects": [%q]}`, dir)))
+		assert.Nil(t, err)
+		assert.True(t, user.Trusts(filepath.Join(dir, defaults.ProjectFileName)))
+		assert.False(t, user.Trusts(filepath.Join(dir, "sub", defaults.ProjectFileName)))
+		var none *defaults.Source
+		assert.False(t, none.Trusts(filepath.Join(dir, defaults.ProjectFileName)))
+	})
+
+	for _, tc := range []struct {
+		title   string
+		origin  string
+		content string
+		want    string
+	}{
+		{
+			title:   "trusted projects in project file",
+			origin:  defaults.OriginProject,
+			content: `{"trustedProjects": ["/"]}`,
+			want:    "trustedProjects is available only in the user file",
+		},
+		{
+			title:   "relative trusted project",
+			content: `{"trustedProjects": ["repo"]}`,
+			want:    `"repo" should be absolute`,
+		},
+		{
+			title:   "unknown flag",
+			content: `{"color": true}`,
+			want:    `unknown flag "color"`,
+		},
+		{
+			title:   "many values",
+			content: `{"diff": ["diff", "cmp"]}`,
+			want:    "diff should have a value",
+		},
+		{
+			title:   "invalid value",
+			content: `{"label": "yes"}`,
+			want:    "invalid syntax",
+		},
+		{
+			title:   "object value",
+			content: `{"diff": {"a": 1}}`,
+			want:    "unsupported value",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			fs, _, _, _, _ := newFlagSet()
+			origin := tc.origin
+			if origin == "" {
+				origin = defaults.OriginUser
+			}
+			s, err := defaults.ReadFile(origin, writeFile(t, tc.content))
+			if err == nil {
+				_, err = defaults.Apply(fs, s)
+			}
+			assert.ErrorIs(t, err, defaults.ErrDefaults)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+	newFlagSet := func() *pflag.FlagSet {
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		_ = fs.String("diff", "diff", "")
+		_ = fs.StringArray("preprocess", nil, "")
+		_ = fs.StringArray(defaults.ProfileFlag, nil, "")
+		return fs
+	}
+	file := &defaults.Source{
+		Origin: defaults.OriginUser,
+		Path:   "config.json",
+		Profiles: defaults.Profiles{
+			"unified": {"diff": {"diff -U1"}},
+			"upper":   {"preprocess": {"tr a-z A-Z"}},
+		},
+	}
+
+	t.Run("stack", func(t *testing.T) {
+		fs := newFlagSet()
+		assert.Nil(t, fs.Parse([]string{"--profile", "yaml-gron", "--profile", "unified", "--profile", "upper"}))
+		names := defaults.ProfileNames(fs, file)
+		assert.Equal(t, []string{"yaml-gron", "unified", "upper"}, names)
+		s, err := defaults.NewProfileSource(fs, names, file)
+		assert.Nil(t, err)
+		origins, err := defaults.Apply(fs, s)
+		assert.Nil(t, err)
+
+		diff, _ := fs.GetString("diff")
+		assert.Equal(t, "diff -U1", diff, "the profile of the file should override the built-in profile")
+		preprocess, _ := fs.GetStringArray("preprocess")
+		assert.Equal(t, []string{"yq -o json", "gron", "tr a-z A-Z"}, preprocess)
+		assert.Equal(t, "profile yaml-gron,upper", origins["preprocess"])
+		assert.Equal(t, "profile unified", origins["diff"])
+	})
+
+	t.Run("flag overrides profile", func(t *testing.T) {
+		fs := newFlagSet()
+		assert.Nil(t, fs.Parse([]string{"--diff", "cmp"}))
+		s, err := defaults.NewProfileSource(fs, []string{"json-pretty"})
+		assert.Nil(t, err)
+		_, err = defaults.Apply(fs, s)
+		assert.Nil(t, err)
+		diff, _ := fs.GetString("diff")
+		assert.Equal(t, "cmp", diff)
+		preprocess, _ := fs.GetStringArray("preprocess")
+		assert.Equal(t, []string{"jq -S ."}, preprocess)
+	})
+
+	t.Run("names from env", func(t *testing.T) {
+		fs := newFlagSet()
+		t.Setenv("CMDCOMP_PROFILE", "unified\nupper")
+		assert.Equal(t, []string{"unified", "upper"}, defaults.ProfileNames(fs, defaults.NewEnvSource(fs), file))
+	})
+
+	for _, tc := range []struct {
+		title   string
+		profile defaults.Profile
+		want    string
+	}{
+		{
+			title: "unknown profile",
+			want:  `unknown profile "x"`,
+		},
+		{
+			title:   "unknown flag",
+			profile: defaults.Profile{"color": {"true"}},
+			want:    `unknown flag "color" in profile x`,
+		},
+		{
+			title:   "nested",
+			profile: defaults.Profile{defaults.ProfileFlag: {"unified"}},
+			want:    "profile x cannot select profiles",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			s := &defaults.Source{Profiles: defaults.Profiles{}}
+			if tc.profile != nil {
+				s.Profiles["x"] = tc.profile
+			}
+			_, err := defaults.NewProfileSource(newFlagSet(), []string{"x"}, s)
+			assert.ErrorIs(t, err, defaults.ErrDefaults)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+
+	t.Run("read profiles", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "config.json")
+		assert.Nil(t, os.WriteFile(p, []byte(`{"diff": "cmp", "profiles": {"upper": {"preprocess": ["tr a-z A-Z"], "label": true}}}`), 0o600))
+		s, err := defaults.ReadFile(defaults.OriginProject, p)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string][]string{"diff": {"cmp"}}, s.Values)
+		assert.Equal(t, defaults.Profiles{
+			"upper": {"preprocess": {"tr a-z A-Z"}, "label": {"true"}},
+		}, s.Profiles)
+	})
+}
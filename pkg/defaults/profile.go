@@ -0,0 +1,146 @@
+package defaults
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+// ProfileFlag is the name of the flag selecting the profiles.
+const ProfileFlag = "profile"
+
+const profilesKey = "profiles"
+
+// Profile is a named set of the values of the flags.
+type Profile map[string][]string
+
+// Profiles are the profiles by names.
+type Profiles map[string]Profile
+
+// Builtin are the built-in profiles.
+var Builtin = Profiles{
+	"unified": {
+		"diff": {"diff -u --color"},
+	},
+	"helm-secrets": {
+		"preprocess": {`yq 'select(.kind=="Secret")'`},
+	},
+	"k8s-deployments": {
+		"preprocess": {`yq 'select(.kind=="Deployment")' -o json`, "gron"},
+	},
+	"yaml-gron": {
+		"preprocess": {"yq -o json", "gron"},
+	},
+	"json-pretty": {
+		"preprocess": {"jq -S ."},
+		"diff":       {"diff -u"},
+	},
+}
+
+// ProfileNames returns the names of the selected profiles:
+// the profile flag if given on the command line, or the first source having the profile flag.
+func ProfileNames(fs *pflag.FlagSet, sources ...*Source) []string {
+	if f := fs.Lookup(ProfileFlag); f != nil && f.Changed {
+		xs, _ := fs.GetStringArray(ProfileFlag)
+		return xs
+	}
+	for _, s := range sources {
+		if s == nil {
+			continue
+		}
+		if xs, ok := s.Values[ProfileFlag]; ok {
+			return xs
+		}
+	}
+	return nil
+}
+
+// lookupProfile returns the profile defined in the first source having it, or the built-in profile.
+func lookupProfile(name string, sources ...*Source) (Profile, string, bool) {
+	for _, s := range sources {
+		if s == nil {
+			continue
+		}
+		if p, ok := s.Profiles[name]; ok {
+			return p, s.Path, true
+		}
+	}
+	p, ok := Builtin[name]
+	return p, "builtin", ok
+}
+
+// NewProfileSource stacks the profiles in order.
+// The later profiles override the values of the earlier ones,
+// and the values of the repeatable flags are appended, e.g. the preprocess chains.
+func NewProfileSource(fs *pflag.FlagSet, names []string, sources ...*Source) (*Source, error) {
+	s := &Source{
+		Origin: OriginProfile,
+		Values: map[string][]string{},
+		names:  map[string]string{},
+	}
+	for _, name := range names {
+		p, _, ok := lookupProfile(name, sources...)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown profile %q", ErrDefaults, name)
+		}
+		for _, flag := range slices.Sorted(maps.Keys(p)) {
+			f := fs.Lookup(flag)
+			if f == nil {
+				return nil, fmt.Errorf("%w: unknown flag %q in profile %s", ErrDefaults, flag, name)
+			}
+			if flag == ProfileFlag {
+				return nil, fmt.Errorf("%w: profile %s cannot select profiles", ErrDefaults, name)
+			}
+			if isRepeatable(f) {
+				s.Values[flag] = append(s.Values[flag], p[flag]...)
+				s.names[flag] = appendName(s.names[flag], name)
+			} else {
+				s.Values[flag] = p[flag]
+				s.names[flag] = name
+			}
+		}
+	}
+	return s, nil
+}
+
+func appendName(names, name string) string {
+	if names == "" {
+		return name
+	}
+	return names + "," + name
+}
+
+// AvailableProfiles returns the names of the built-in profiles and the profiles of the sources.
+func AvailableProfiles(sources ...*Source) []string {
+	names := slices.Collect(maps.Keys(Builtin))
+	for _, s := range sources {
+		if s != nil {
+			names = append(names, slices.Collect(maps.Keys(s.Profiles))...)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// ShowProfiles writes the available profiles, the profiles of the files override the built-in profiles.
+func ShowProfiles(w io.Writer, sources ...*Source) error {
+	names := AvailableProfiles(sources...)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PROFILE\tORIGIN\tFLAGS")
+	for _, name := range names {
+		p, origin, _ := lookupProfile(name, sources...)
+		var flags []string
+		for _, flag := range slices.Sorted(maps.Keys(p)) {
+			for _, v := range p[flag] {
+				flags = append(flags, fmt.Sprintf("--%s=%s", flag, v))
+			}
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", name, origin, strings.Join(flags, " "))
+	}
+	return tw.Flush()
+}
@@ -9,35 +9,143 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	ex "github.com/berquerant/execx"
 )
 
 type Cmd struct {
-	tmpDir string
-	args   []string
+	tmpDir      string
+	gracePeriod time.Duration
+	args        []string
+	limit       Limit
+	state       *os.ProcessState
 }
 
-func NewCmd(tmpDir string, arg ...string) *Cmd {
+func NewCmd(tmpDir string, gracePeriod time.Duration, arg ...string) *Cmd {
 	return &Cmd{
-		tmpDir: tmpDir,
-		args:   arg,
+		tmpDir:      tmpDir,
+		gracePeriod: gracePeriod,
+		args:        arg,
 	}
 }
 
 var ErrRun = errors.New("Run")
 
-func (c *Cmd) intoExecCmd(ctx context.Context) (*exec.Cmd, error) {
+// ErrStreamSource means that the source command of Stream failed, not the pipeline.
+var ErrStreamSource = errors.New("stream source")
+
+// SetLimit limits the size of the output of Run.
+func (c *Cmd) SetLimit(limit Limit) {
+	c.limit = limit
+}
+
+func (c *Cmd) intoExecCmd(ctx context.Context) (*ExecCmd, error) {
 	if len(c.args) == 0 {
 		return nil, fmt.Errorf("%w: no args", ErrRun)
 	}
 
-	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	return newGroupExecCmd(ctx, c.gracePeriod, c.args[0], c.args[1:]...), nil
+}
+
+// NewExecCmd returns a command that runs in the process group of cmdcomp,
+// so that it can read from the terminal like an interactive diff command.
+//
+// When ctx is done, the process receives SIGTERM,
+// and then SIGKILL after gracePeriod.
+func NewExecCmd(ctx context.Context, gracePeriod time.Duration, name string, arg ...string) *ExecCmd {
+	return newExecCmd(ctx, gracePeriod, false, name, arg...)
+}
+
+// newGroupExecCmd returns a command that runs in its own process group,
+// for the commands generating the outputs that may spawn the processes to be killed together.
+//
+// When ctx is done, the whole process group receives SIGTERM,
+// and then SIGKILL after gracePeriod to kill the remaining processes.
+func newGroupExecCmd(ctx context.Context, gracePeriod time.Duration, name string, arg ...string) *ExecCmd {
+	return newExecCmd(ctx, gracePeriod, true, name, arg...)
+}
+
+func newExecCmd(ctx context.Context, gracePeriod time.Duration, group bool, name string, arg ...string) *ExecCmd {
+	cmd := &ExecCmd{
+		Cmd: exec.CommandContext(ctx, name, arg...),
+	}
 	cmd.Env = os.Environ()
-	return cmd, nil
+	if group {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	cmd.Cancel = func() error {
+		pid := cmd.Process.Pid
+		if group {
+			// negative pid means the process group
+			pid = -pid
+		}
+		if gracePeriod <= 0 {
+			return syscall.Kill(pid, syscall.SIGKILL)
+		}
+		cmd.killAfter(gracePeriod, pid)
+		return syscall.Kill(pid, syscall.SIGTERM)
+	}
+	// wait for the stdout and stderr to be closed by the children
+	cmd.WaitDelay = gracePeriod
+	return cmd
+}
+
+// ExecCmd is an exec.Cmd killed with a grace period when its context is done.
+type ExecCmd struct {
+	*exec.Cmd
+	mu sync.Mutex
+	// kill sends SIGKILL after the grace period.
+	kill *time.Timer
+	// waited is true after Wait returned.
+	waited bool
+}
+
+// killAfter sends SIGKILL to pid after d unless Wait returns before.
+func (c *ExecCmd) killAfter(d time.Duration, pid int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.waited {
+		return
+	}
+	c.kill = time.AfterFunc(d, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// the pid may have been reused after the process was reaped
+		if c.waited || errors.Is(c.Process.Signal(syscall.Signal(0)), os.ErrProcessDone) {
+			return
+		}
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	})
+}
+
+// stopKill stops the pending SIGKILL; the process has been reaped.
+func (c *ExecCmd) stopKill() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waited = true
+	if c.kill != nil {
+		c.kill.Stop()
+	}
+}
+
+// Wait waits for the command to exit and stops the pending SIGKILL.
+func (c *ExecCmd) Wait() error {
+	defer c.stopKill()
+	return c.Cmd.Wait()
+}
+
+// Run starts the command and waits for it.
+func (c *ExecCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
 }
 
-func (c *Cmd) IntoExecCmd(ctx context.Context) (*exec.Cmd, error) {
+func (c *Cmd) IntoExecCmd(ctx context.Context) (*ExecCmd, error) {
 	return c.intoExecCmd(ctx)
 }
 
@@ -55,16 +163,27 @@ func (c *Cmd) Run(ctx context.Context) (string, error) {
 	}
 	defer stdout.Close()
 
-	cmd.Stdout = stdout
+	w := c.limit.newWriter(stdout)
+	cmd.Stdout = w.writer()
 	cmd.Stderr = os.Stderr
 
 	slog.Debug("exec", slog.Any("args", cmd.Args))
-	if err := cmd.Run(); err != nil {
+	err = cmd.Run()
+	c.state = cmd.ProcessState
+	if err := w.err(); err != nil {
+		return "", err
+	}
+	if err != nil {
 		return "", err
 	}
 	return tmpfile.Path(), nil
 }
 
+// ProcessState returns the state of the exited process after Run.
+func (c *Cmd) ProcessState() *os.ProcessState {
+	return c.state
+}
+
 type TmpFile struct {
 	dir  string
 	path string
@@ -94,6 +213,7 @@ type Pipeline struct {
 	stdin io.Reader
 	dir   string
 	path  string
+	limit Limit
 }
 
 func NewPipedCmd(ctx context.Context, dir string, stdin io.Reader, cmd ...*Cmd) *Pipeline {
@@ -108,15 +228,30 @@ func (p Pipeline) Path() string {
 	return p.path
 }
 
+// SetLimit limits the size of the output of the pipeline.
+func (p *Pipeline) SetLimit(limit Limit) {
+	p.limit = limit
+}
+
 func (p *Pipeline) Run(ctx context.Context) error {
-	xs := make([]*exec.Cmd, len(p.cmds))
+	var (
+		xs    = make([]*exec.Cmd, len(p.cmds))
+		execs = make([]*ExecCmd, len(p.cmds))
+	)
 	for i, c := range p.cmds {
 		x, err := c.intoExecCmd(ctx)
 		if err != nil {
 			return fmt.Errorf("%w: failed to convert cmds[%d] to exec.Cmd", err, i)
 		}
-		xs[i] = x
+		xs[i] = x.Cmd
+		execs[i] = x
 	}
+	// the pipeline waits for the exec.Cmds
+	defer func() {
+		for _, x := range execs {
+			x.stopKill()
+		}
+	}()
 	cmd, err := ex.NewPipedCmd(xs...)
 	if err != nil {
 		return err
@@ -130,12 +265,126 @@ func (p *Pipeline) Run(ctx context.Context) error {
 	defer stdout.Close()
 
 	p.path = stdoutFile.Path()
+	w := p.limit.newWriter(stdout)
 	cmd.Stdin = p.stdin
-	cmd.Stdout = stdout
+	cmd.Stdout = w.writer()
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Start(ctx); err != nil {
 		return err
 	}
-	return cmd.Wait()
+	err = cmd.Wait()
+	if err := w.err(); err != nil {
+		return err
+	}
+	return err
+}
+
+// Stream pipes the stdout of a command into a pipeline
+// without writing the intermediate output to a file.
+type Stream struct {
+	cmd      *Cmd
+	pipeline *Pipeline
+	tee      string
+}
+
+// NewStream returns a stream from cmd to the pipeline of pipe.
+// If tee is not empty, the stdout of cmd is also written to tee.
+func NewStream(ctx context.Context, dir, tee string, cmd *Cmd, pipe ...*Cmd) *Stream {
+	return &Stream{
+		cmd:      cmd,
+		pipeline: NewPipedCmd(ctx, dir, nil, pipe...),
+		tee:      tee,
+	}
+}
+
+// Path returns the filepath where the output of the pipeline was written.
+func (s Stream) Path() string {
+	return s.pipeline.Path()
+}
+
+// Run executes the command and the pipeline concurrently.
+func (s *Stream) Run(ctx context.Context) (retErr error) {
+	cmd, err := s.cmd.intoExecCmd(ctx)
+	if err != nil {
+		return err
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer pr.Close()
+
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = pw
+	if s.tee != "" {
+		f, err := os.Create(s.tee)
+		if err != nil {
+			_ = pw.Close()
+			return err
+		}
+		defer f.Close()
+		w := s.cmd.limit.newWriter(f)
+		defer func() {
+			if err := w.err(); err != nil && retErr == nil {
+				retErr = fmt.Errorf("%w: %w", err, ErrStreamSource)
+			}
+		}()
+		cmd.Stdout = io.MultiWriter(pw, w.writer())
+	}
+
+	slog.Debug("exec", slog.Any("args", cmd.Args), slog.String("tee", s.tee))
+	if err := cmd.Start(); err != nil {
+		_ = pw.Close()
+		return err
+	}
+	errC := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		s.cmd.state = cmd.ProcessState
+		// close the write end to send EOF to the pipeline
+		_ = pw.Close()
+		errC <- err
+	}()
+
+	s.pipeline.stdin = pr
+	pipeErr := s.pipeline.Run(ctx)
+	if s.tee == "" {
+		// unblock the command if the pipeline exited early
+		_ = pr.Close()
+	} else {
+		// the tee needs the whole output,
+		// and cmdcomp writing to the closed pipe raises SIGPIPE that cancels the run
+		go func() {
+			_, _ = io.Copy(io.Discard, pr)
+		}()
+	}
+	srcErr := <-errC
+	if pipeErr != nil {
+		// the command may fail because the pipeline exited early
+		return pipeErr
+	}
+	if srcErr != nil && !isBrokenPipe(srcErr) {
+		return fmt.Errorf("%w: %w", srcErr, ErrStreamSource)
+	}
+	return nil
+}
+
+// isBrokenPipe returns true if the command was killed by SIGPIPE
+// because the pipeline exited without reading all the output.
+func isBrokenPipe(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() && ws.Signal() == syscall.SIGPIPE {
+		return true
+	}
+	// the shell reports the signal as 128+n
+	return exitErr.ExitCode() == 128+int(syscall.SIGPIPE)
+}
+
+// SetLimit limits the size of the output of the pipeline.
+func (s *Stream) SetLimit(limit Limit) {
+	s.pipeline.SetLimit(limit)
 }
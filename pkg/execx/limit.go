@@ -0,0 +1,84 @@
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrOutputTooLarge = errors.New("OutputTooLarge")
+
+// Limit limits the size of the output.
+type Limit struct {
+	// Size is the max bytes of the output; 0 means no limit.
+	Size int64
+	// Truncate discards the rest of the output and appends a marker
+	// instead of failing when the output exceeds Size.
+	Truncate bool
+}
+
+// TruncatedMarker returns the line appended to the truncated output.
+func TruncatedMarker(size int64) string {
+	return fmt.Sprintf("\n[cmdcomp: output truncated at %d bytes]\n", size)
+}
+
+func (l Limit) newWriter(w io.Writer) *limitWriter {
+	return &limitWriter{
+		w:     w,
+		limit: l,
+	}
+}
+
+type limitWriter struct {
+	w        io.Writer
+	limit    Limit
+	n        int64
+	exceeded bool
+}
+
+// writer returns the underlying writer if there is no limit
+// so that the command writes to the file directly.
+func (w *limitWriter) writer() io.Writer {
+	if w.limit.Size <= 0 {
+		return w.w
+	}
+	return w
+}
+
+// err returns ErrOutputTooLarge if the output exceeded the limit and was not truncated.
+func (w *limitWriter) err() error {
+	if w.exceeded && !w.limit.Truncate {
+		return fmt.Errorf("%w: exceeded %d bytes", ErrOutputTooLarge, w.limit.Size)
+	}
+	return nil
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.limit.Size <= 0 {
+		return w.w.Write(p)
+	}
+	if w.exceeded {
+		if w.limit.Truncate {
+			// discard the rest to let the command finish
+			return len(p), nil
+		}
+		return 0, w.err()
+	}
+	if rest := w.limit.Size - w.n; int64(len(p)) > rest {
+		w.exceeded = true
+		if !w.limit.Truncate {
+			return 0, w.err()
+		}
+		if _, err := w.w.Write(p[:rest]); err != nil {
+			return 0, err
+		}
+		w.n += rest
+		if _, err := io.WriteString(w.w, TruncatedMarker(w.limit.Size)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var ErrGraph = errors.New("Graph")
+
+// Stage is a node of the graph.
+type Stage struct {
+	Name string
+	// Inputs are the stages whose outputs are passed to Run in order.
+	Inputs []string
+	// After are the stages to be finished before this stage, without their outputs.
+	After []string
+	// Run executes the stage with the outputs of Inputs and returns the output of the stage.
+	Run func(ctx context.Context, inputs []string) (string, error)
+}
+
+func (s Stage) deps() []string {
+	return append(slices.Clone(s.Inputs), s.After...)
+}
+
+// Graph is a DAG of the stages.
+type Graph struct {
+	stages []*Stage
+	index  map[string]*Stage
+}
+
+func New() *Graph {
+	return &Graph{
+		index: map[string]*Stage{},
+	}
+}
+
+// Add adds the stage to the graph.
+func (g *Graph) Add(s *Stage) error {
+	if s.Name == "" {
+		return fmt.Errorf("%w: no stage name", ErrGraph)
+	}
+	if _, ok := g.index[s.Name]; ok {
+		return fmt.Errorf("%w: duplicated stage %q", ErrGraph, s.Name)
+	}
+	g.stages = append(g.stages, s)
+	g.index[s.Name] = s
+	return nil
+}
+
+// Stages returns the stages in the order of Add.
+func (g *Graph) Stages() []*Stage {
+	return g.stages
+}
+
+// Order returns the names of the stages in a topological order,
+// keeping the order of Add as much as possible.
+// Returns an error if there are unknown dependencies or cycles.
+func (g *Graph) Order() ([]string, error) {
+	for _, s := range g.stages {
+		for _, d := range s.deps() {
+			if _, ok := g.index[d]; !ok {
+				return nil, fmt.Errorf("%w: stage %q depends on unknown stage %q", ErrGraph, s.Name, d)
+			}
+		}
+	}
+
+	var (
+		order []string
+		done  = map[string]bool{}
+	)
+	for len(order) < len(g.stages) {
+		progress := false
+		for _, s := range g.stages {
+			if done[s.Name] {
+				continue
+			}
+			if slices.ContainsFunc(s.deps(), func(d string) bool { return !done[d] }) {
+				continue
+			}
+			done[s.Name] = true
+			order = append(order, s.Name)
+			progress = true
+		}
+		if !progress {
+			var rest []string
+			for _, s := range g.stages {
+				if !done[s.Name] {
+					rest = append(rest, s.Name)
+				}
+			}
+			return nil, fmt.Errorf("%w: cycle in stages %s", ErrGraph, strings.Join(rest, ", "))
+		}
+	}
+	return order, nil
+}
+
+// Run executes the stages concurrently; each stage starts as soon as its dependencies finish.
+// The first error cancels the other stages.
+// Returns the outputs of the stages.
+func (g *Graph) Run(ctx context.Context) (map[string]string, error) {
+	if _, err := g.Order(); err != nil {
+		return nil, err
+	}
+
+	var (
+		outputs   = make(map[string]string, len(g.stages))
+		done      = make(map[string]chan struct{}, len(g.stages))
+		results   = make(map[string]*string, len(g.stages))
+		eg, egCtx = errgroup.WithContext(ctx)
+	)
+	for _, s := range g.stages {
+		done[s.Name] = make(chan struct{})
+		results[s.Name] = new(string)
+	}
+	for _, s := range g.stages {
+		eg.Go(func() error {
+			for _, d := range s.deps() {
+				select {
+				case <-done[d]:
+				case <-egCtx.Done():
+					return context.Cause(egCtx)
+				}
+			}
+			inputs := make([]string, len(s.Inputs))
+			for i, x := range s.Inputs {
+				inputs[i] = *results[x]
+			}
+			out, err := s.Run(egCtx, inputs)
+			if err != nil {
+				return err
+			}
+			// the dependents read the result after done is closed
+			*results[s.Name] = out
+			close(done[s.Name])
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	for name, x := range results {
+		outputs[name] = *x
+	}
+	return outputs, nil
+}
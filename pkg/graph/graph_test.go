@@ -0,0 +1,124 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/berquerant/cmdcomp/pkg/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrder(t *testing.T) {
+	for _, tc := range []struct {
+		title  string
+		stages []*graph.Stage
+		want   []string
+		errMsg string
+	}{
+		{
+			title: "default",
+			stages: []*graph.Stage{
+				{Name: "diff", Inputs: []string{"lp", "rp"}},
+				{Name: "left"},
+				{Name: "lp", Inputs: []string{"left"}},
+				{Name: "right", After: []string{"hook"}},
+				{Name: "rp", Inputs: []string{"right"}},
+				{Name: "hook", After: []string{"left"}},
+			},
+			want: []string{"left", "lp", "hook", "right", "rp", "diff"},
+		},
+		{
+			title: "unknown",
+			stages: []*graph.Stage{
+				{Name: "a", Inputs: []string{"b"}},
+			},
+			errMsg: `stage "a" depends on unknown stage "b"`,
+		},
+		{
+			title: "cycle",
+			stages: []*graph.Stage{
+				{Name: "a"},
+				{Name: "b", Inputs: []string{"c"}},
+				{Name: "c", After: []string{"b"}},
+			},
+			errMsg: "cycle in stages b, c",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			g := graph.New()
+			for _, s := range tc.stages {
+				assert.Nil(t, g.Add(s))
+			}
+			got, err := g.Order()
+			if tc.errMsg != "" {
+				assert.ErrorIs(t, err, graph.ErrGraph)
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	g := graph.New()
+	assert.Nil(t, g.Add(&graph.Stage{Name: "a"}))
+	assert.ErrorIs(t, g.Add(&graph.Stage{Name: "a"}), graph.ErrGraph)
+	assert.ErrorIs(t, g.Add(&graph.Stage{}), graph.ErrGraph)
+}
+
+func TestRun(t *testing.T) {
+	var (
+		mux   sync.Mutex
+		trace []string
+	)
+	stage := func(name string, inputs, after []string) *graph.Stage {
+		return &graph.Stage{
+			Name:   name,
+			Inputs: inputs,
+			After:  after,
+			Run: func(_ context.Context, xs []string) (string, error) {
+				mux.Lock()
+				defer mux.Unlock()
+				trace = append(trace, name)
+				return name + "(" + strings.Join(xs, ",") + ")", nil
+			},
+		}
+	}
+
+	g := graph.New()
+	assert.Nil(t, g.Add(stage("diff", []string{"lp", "right"}, nil)))
+	assert.Nil(t, g.Add(stage("left", nil, nil)))
+	assert.Nil(t, g.Add(stage("lp", []string{"left"}, nil)))
+	assert.Nil(t, g.Add(stage("right", nil, []string{"left"})))
+	got, err := g.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "diff(lp(left()),right())", got["diff"])
+	assert.Equal(t, "left", trace[0])
+	assert.Equal(t, "diff", trace[3])
+
+	t.Run("error", func(t *testing.T) {
+		errStage := errors.New("stage")
+		g := graph.New()
+		assert.Nil(t, g.Add(&graph.Stage{
+			Name: "a",
+			Run: func(context.Context, []string) (string, error) {
+				return "", errStage
+			},
+		}))
+		assert.Nil(t, g.Add(&graph.Stage{
+			Name: "b",
+			Run: func(ctx context.Context, _ []string) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+		}))
+		assert.Nil(t, g.Add(stage("c", []string{"a"}, nil)))
+		_, err := g.Run(context.Background())
+		assert.ErrorIs(t, err, errStage)
+	})
+}
@@ -0,0 +1,99 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/berquerant/cmdcomp/pkg/bench"
+	"github.com/berquerant/cmdcomp/pkg/config"
+)
+
+// runBench runs each command --bench times sequentially
+// and writes the comparison of the resource usage.
+// Returns the outputs of the last runs.
+//
+// The comparison is written to stderr unless --benchOnly, not to corrupt the diff in stdout.
+//
+// Without interceptors, left and right run alternately to reduce the drift of the environment.
+func (r *runner) runBench(ctx context.Context) (*cmdResult, error) {
+	var (
+		left, right  = r.GetLeft(), r.GetRight()
+		result       cmdResult
+		leftSamples  []bench.Sample
+		rightSamples []bench.Sample
+		runLeftBench = func() error {
+			out, s, err := r.runBenchCmd(ctx, left)
+			if err != nil {
+				return err
+			}
+			result.leftOut = out
+			leftSamples = append(leftSamples, s)
+			return nil
+		}
+		runRightBench = func() error {
+			out, s, err := r.runBenchCmd(ctx, right)
+			if err != nil {
+				return err
+			}
+			result.rightOut = out
+			rightSamples = append(rightSamples, s)
+			return nil
+		}
+	)
+
+	if len(r.Interceptor) > 0 {
+		for range r.Bench {
+			if err := runLeftBench(); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.runInterceptors(ctx, nil); err != nil {
+			return nil, errors.Join(err, r.runUndo(ctx))
+		}
+		for range r.Bench {
+			if err := runRightBench(); err != nil {
+				return nil, errors.Join(err, r.runUndo(ctx))
+			}
+		}
+		if err := r.runUndo(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		for range r.Bench {
+			if err := runLeftBench(); err != nil {
+				return nil, err
+			}
+			if err := runRightBench(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	w := io.Writer(os.Stderr)
+	if r.BenchOnly {
+		w = r.Writer
+	}
+	if err := bench.Write(w, r.Bench, bench.Compare(leftSamples, rightSamples)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// runBenchCmd runs the command of the side without the cache and the retries.
+func (r *runner) runBenchCmd(ctx context.Context, side config.Side) (string, bench.Sample, error) {
+	ctx, cancel := r.withTimeout(ctx, side.Name)
+	defer cancel()
+	c := r.newCmd(side.Args...)
+	x := newCmdLog(stageGenerate, side.Name, 0, side.Args)
+	out, err := c.Run(ctx)
+	err = timeoutError(ctx, err)
+	x.close(out, err)
+	r.logC <- x
+	if err != nil {
+		return "", bench.Sample{}, fmt.Errorf("%w: %w: run %s", ErrGenerate, err, side.Name)
+	}
+	return out, bench.NewSample(x.end.Sub(x.start), c.ProcessState()), nil
+}
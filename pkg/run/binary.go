@@ -0,0 +1,82 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/content"
+	"github.com/berquerant/cmdcomp/pkg/execx"
+)
+
+// compareBinary handles the outputs containing NUL bytes according to --binary.
+// Returns the files to be passed to the diff command,
+// or true if the comparison was done without the diff command.
+func (r *runner) compareBinary(leftSide, rightSide config.Side, left, right string) (string, string, bool, error) {
+	if r.Binary == config.BinaryText {
+		return left, right, false, nil
+	}
+	leftBinary, err := content.IsBinary(left)
+	if err != nil {
+		return "", "", false, errors.Join(ErrDiff, err)
+	}
+	rightBinary, err := content.IsBinary(right)
+	if err != nil {
+		return "", "", false, errors.Join(ErrDiff, err)
+	}
+	if !leftBinary && !rightBinary {
+		return left, right, false, nil
+	}
+
+	if r.Binary == config.BinaryHexdump {
+		if left, err = r.hexdump(left); err != nil {
+			return "", "", false, errors.Join(ErrDiff, err)
+		}
+		if right, err = r.hexdump(right); err != nil {
+			return "", "", false, errors.Join(ErrDiff, err)
+		}
+		return left, right, false, nil
+	}
+
+	leftSum, err := content.Checksum(left)
+	if err != nil {
+		return "", "", false, errors.Join(ErrDiff, err)
+	}
+	rightSum, err := content.Checksum(right)
+	if err != nil {
+		return "", "", false, errors.Join(ErrDiff, err)
+	}
+	if *leftSum == *rightSum {
+		return left, right, true, nil
+	}
+	leftLabel, rightLabel, err := r.sideLabels(leftSide, rightSide)
+	if err != nil {
+		return "", "", false, errors.Join(ErrDiff, err)
+	}
+	if _, err := fmt.Fprintf(r.Writer, "Binary outputs %s and %s differ\n< %s\n> %s\n",
+		leftLabel, rightLabel, leftSum, rightSum,
+	); err != nil {
+		return "", "", false, errors.Join(ErrDiff, err)
+	}
+	return left, right, true, errors.Join(ErrDiff, ErrDiffFound)
+}
+
+// hexdump writes the hexdump of the file to a new temporary file.
+func (r *runner) hexdump(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	f := execx.NewTmpFile(r.TempDir)
+	out, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	if err := content.Hexdump(out, in); err != nil {
+		_ = out.Close()
+		return "", err
+	}
+	return f.Path(), out.Close()
+}
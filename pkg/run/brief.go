@@ -0,0 +1,69 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/content"
+)
+
+type briefReport struct {
+	Same  bool       `json:"same"`
+	Left  *briefSide `json:"left"`
+	Right *briefSide `json:"right"`
+}
+
+type briefSide struct {
+	Name string `json:"name"`
+	// Label is the customized label of the side.
+	Label string `json:"label,omitempty"`
+	*content.Sum
+}
+
+// compareHash compares the sha256 of the outputs instead of running the diff command.
+func (r *runner) compareHash(leftSide, rightSide config.Side, left, right string) error {
+	leftSum, err := content.Checksum(left)
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	rightSum, err := content.Checksum(right)
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	leftLabel, rightLabel, custom, err := r.GetLabels(leftSide, rightSide)
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	x := briefReport{
+		Same: *leftSum == *rightSum,
+		Left: &briefSide{
+			Name: leftSide.Name,
+			Sum:  leftSum,
+		},
+		Right: &briefSide{
+			Name: rightSide.Name,
+			Sum:  rightSum,
+		},
+	}
+	if custom {
+		x.Left.Label, x.Right.Label = leftLabel, rightLabel
+	} else {
+		leftLabel, rightLabel = leftSide.Name, rightSide.Name
+	}
+
+	switch {
+	case r.Brief == config.BriefJSON:
+		err = json.NewEncoder(r.Writer).Encode(x)
+	case r.Brief == config.BriefText && !x.Same:
+		_, err = fmt.Fprintf(r.Writer, "Outputs %s and %s differ\n", leftLabel, rightLabel)
+	}
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	if x.Same {
+		return nil
+	}
+	return errors.Join(ErrDiff, ErrDiffFound)
+}
@@ -0,0 +1,244 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	stageGenerate    = "generate"
+	stagePreprocess  = "preprocess"
+	stageInterceptor = "interceptor"
+	stageDiff        = "diff"
+	stageHook        = "hook"
+	stageReport      = "report"
+)
+
+type cmdLog struct {
+	args []string
+	// stage is one of generate, preprocess, interceptor, diff, hook and report.
+	stage string
+	// phase is the hook phase if the stage is hook.
+	phase string
+	// side is the name of the side or empty if the stage belongs to no side.
+	side     string
+	in       string
+	out      string
+	start    time.Time
+	end      time.Time
+	elapsed  int64
+	exitCode int
+	err      string
+	// cache is "hit" or "miss" if the cache is enabled.
+	cache string
+	// attempt is the number of the retries.
+	attempt int
+}
+
+func (c cmdLog) intoSlogAttrs() []any {
+	xs := []any{}
+	xs = append(xs, slog.String("args", strings.Join(c.args, " ")))
+	xs = append(xs, slog.String("stage", c.stage))
+	if x := c.phase; x != "" {
+		xs = append(xs, slog.String("phase", x))
+	}
+	if x := c.side; x != "" {
+		xs = append(xs, slog.String("side", x))
+	}
+	if x := c.in; x != "" {
+		xs = append(xs, slog.String("in", x))
+	}
+	if x := c.out; x != "" {
+		xs = append(xs, slog.String("out", x))
+	}
+	xs = append(xs, slog.Time("start", c.start))
+	xs = append(xs, slog.Time("end", c.end))
+	xs = append(xs, slog.Int64("elapsed_ms", c.elapsed))
+	if x := c.err; x != "" {
+		xs = append(xs, slog.String("err", x))
+	}
+	if x := c.cache; x != "" {
+		xs = append(xs, slog.String("cache", x))
+	}
+	if x := c.attempt; x > 0 {
+		xs = append(xs, slog.Int("attempt", x))
+	}
+	return xs
+}
+
+// The JSON representation of cmdLog.
+type cmdLogJSON struct {
+	Args      []string  `json:"args"`
+	Stage     string    `json:"stage"`
+	Phase     string    `json:"phase,omitempty"`
+	Side      string    `json:"side,omitempty"`
+	In        string    `json:"in,omitempty"`
+	Out       string    `json:"out,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	ElapsedMs int64     `json:"elapsed_ms"`
+	ExitCode  int       `json:"exit_code"`
+	Err       string    `json:"err,omitempty"`
+	Cache     string    `json:"cache,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"`
+}
+
+func (c cmdLog) intoJSON() *cmdLogJSON {
+	return &cmdLogJSON{
+		Args:      c.args,
+		Stage:     c.stage,
+		Phase:     c.phase,
+		Side:      c.side,
+		In:        c.in,
+		Out:       c.out,
+		Start:     c.start,
+		End:       c.end,
+		ElapsedMs: c.elapsed,
+		ExitCode:  c.exitCode,
+		Err:       c.err,
+		Cache:     c.cache,
+		Attempt:   c.attempt,
+	}
+}
+
+func newCmdLog(stage, side string, attempt int, args []string) *cmdLog {
+	return &cmdLog{
+		args:    args,
+		stage:   stage,
+		side:    side,
+		attempt: attempt,
+		start:   time.Now(),
+	}
+}
+
+func (c *cmdLog) close(out string, err error) {
+	c.end = time.Now()
+	c.elapsed = c.end.Sub(c.start).Milliseconds()
+	c.out = out
+	if err != nil {
+		c.err = err.Error()
+		c.exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			c.exitCode = exitErr.ExitCode()
+		}
+	}
+}
+
+// cmdLogWriter writes the command logs as JSON lines and as Chrome trace events.
+type cmdLogWriter struct {
+	jsonl  io.WriteCloser
+	trace  io.WriteCloser
+	events []*traceEvent
+	// tids are the thread ids of the sides in the trace.
+	tids map[string]int
+}
+
+func newCmdLogWriter(cmdLogFile, traceFile string) (*cmdLogWriter, error) {
+	w := &cmdLogWriter{
+		tids: map[string]int{
+			"left":  1,
+			"right": 2,
+		},
+	}
+	if cmdLogFile != "" {
+		f, err := os.Create(cmdLogFile)
+		if err != nil {
+			return nil, err
+		}
+		w.jsonl = f
+	}
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			if w.jsonl != nil {
+				_ = w.jsonl.Close()
+			}
+			return nil, err
+		}
+		w.trace = f
+	}
+	return w, nil
+}
+
+func (w *cmdLogWriter) write(x *cmdLog) {
+	if w.jsonl != nil {
+		b, _ := json.Marshal(x.intoJSON())
+		if _, err := w.jsonl.Write(append(b, '\n')); err != nil {
+			slog.Warn("failed to write command log", slog.Any("err", err))
+		}
+	}
+	if w.trace != nil {
+		w.events = append(w.events, w.newTraceEvent(x))
+	}
+}
+
+// traceEvent is a complete event of the Chrome trace event format.
+type traceEvent struct {
+	Name  string      `json:"name"`
+	Cat   string      `json:"cat"`
+	Ph    string      `json:"ph"`
+	Ts    int64       `json:"ts"`
+	Dur   int64       `json:"dur"`
+	Pid   int         `json:"pid"`
+	Tid   int         `json:"tid"`
+	Args  *cmdLogJSON `json:"args"`
+	start time.Time
+}
+
+func (w *cmdLogWriter) newTraceEvent(x *cmdLog) *traceEvent {
+	// each side has its own lane, the stages without side share the lane 0
+	tid := 0
+	if x.side != "" {
+		if _, ok := w.tids[x.side]; !ok {
+			w.tids[x.side] = len(w.tids) + 1
+		}
+		tid = w.tids[x.side]
+	}
+	return &traceEvent{
+		Name:  strings.Join(x.args, " "),
+		Cat:   x.stage,
+		Ph:    "X",
+		Dur:   x.end.Sub(x.start).Microseconds(),
+		Pid:   1,
+		Tid:   tid,
+		Args:  x.intoJSON(),
+		start: x.start,
+	}
+}
+
+func (w *cmdLogWriter) close() error {
+	var errs []error
+	if w.jsonl != nil {
+		errs = append(errs, w.jsonl.Close())
+	}
+	if w.trace != nil {
+		errs = append(errs, w.writeTrace(), w.trace.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (w *cmdLogWriter) writeTrace() error {
+	// timestamps are relative to the earliest command
+	var origin time.Time
+	for i, e := range w.events {
+		if i == 0 || e.start.Before(origin) {
+			origin = e.start
+		}
+	}
+	events := []*traceEvent{}
+	for _, e := range w.events {
+		e.Ts = e.start.Sub(origin).Microseconds()
+		events = append(events, e)
+	}
+	return json.NewEncoder(w.trace).Encode(map[string]any{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
@@ -0,0 +1,78 @@
+package run
+
+import (
+	"errors"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+)
+
+// Exit statuses of cmdcomp.
+const (
+	// ExitSame means that the outputs are the same.
+	ExitSame = 0
+	// ExitDiffFound means that the outputs differ.
+	ExitDiffFound = 1
+	// ExitDiffFailed means that the diff command failed, exited with a status other than 0 and 1.
+	ExitDiffFailed = 2
+	// ExitGenerate means that the left or the right command failed.
+	ExitGenerate = 3
+	// ExitPreprocess means that the preprocess failed.
+	ExitPreprocess = 4
+	// ExitTimeout means that --timeout or --deadline exceeded.
+	ExitTimeout = 5
+	// ExitError means the other errors: config, interceptor, hook, undo and so on.
+	ExitError = 6
+)
+
+var (
+	// ErrGenerate means that the left or the right command failed.
+	ErrGenerate = errors.New("Generate")
+	// ErrPreprocess means that the preprocess failed.
+	ErrPreprocess = errors.New("Preprocess")
+)
+
+// cleanupError means that the undo or the teardown failed after the comparison.
+type cleanupError struct {
+	err error
+}
+
+func (e *cleanupError) Error() string { return e.err.Error() }
+func (e *cleanupError) Unwrap() error { return e.err }
+
+// ExitCode returns the exit status of cmdcomp for the result of Main.
+//
+// failOn decides which results fail:
+// diff fails on the diffs and the errors, error fails only on the errors and never always succeeds.
+func ExitCode(err error, failOn string) int {
+	code := exitCode(err)
+	switch {
+	case failOn == config.FailOnNever:
+		return ExitSame
+	case failOn == config.FailOnError && code == ExitDiffFound:
+		return ExitSame
+	default:
+		return code
+	}
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitSame
+	case errors.Is(err, ErrTimeout):
+		return ExitTimeout
+	case errors.Is(err, ErrGenerate):
+		return ExitGenerate
+	case errors.Is(err, ErrPreprocess):
+		return ExitPreprocess
+	case errors.As(err, new(*cleanupError)):
+		// the diffs may be found, but the environment may be broken
+		return ExitError
+	case IsDiffFound(err):
+		return ExitDiffFound
+	case errors.Is(err, ErrDiff):
+		return ExitDiffFailed
+	default:
+		return ExitError
+	}
+}
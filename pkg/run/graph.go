@@ -0,0 +1,277 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/execx"
+	"github.com/berquerant/cmdcomp/pkg/graph"
+)
+
+// Stages of the default graph.
+const (
+	graphLeft            = "left"
+	graphRight           = "right"
+	graphLeftPreprocess  = "left preprocess"
+	graphRightPreprocess = "right preprocess"
+)
+
+// Outputs of the differ stages.
+const (
+	graphSame   = "same"
+	graphDiffer = "differ"
+)
+
+// newDefaultGraph returns the graph of the commands and the preprocess of the sides:
+//
+//	left -> left preprocess
+//	left-isolated interceptors -> (left) -> other interceptors -> right -> undo -> right preprocess
+func (r *runner) newDefaultGraph() *graph.Graph {
+	var (
+		g           = graph.New()
+		left, right = r.GetLeft(), r.GetRight()
+	)
+	add := func(s *graph.Stage) {
+		_ = g.Add(s) // the names are unique
+	}
+
+	add(&graph.Stage{
+		Name: graphLeft,
+		Run: func(ctx context.Context, _ []string) (string, error) {
+			return r.runLeftGenCmd(ctx)
+		},
+	})
+	add(&graph.Stage{
+		Name:   graphLeftPreprocess,
+		Inputs: []string{graphLeft},
+		Run: func(ctx context.Context, inputs []string) (string, error) {
+			return r.runSidePreprocess(ctx, left, inputs[0])
+		},
+	})
+
+	var (
+		prev              []string
+		isolated, others  = r.GetInterceptorIndexes()
+		addInterceptorsAt = func(indexes []int) {
+			for _, i := range indexes {
+				name := fmt.Sprintf("interceptor[%d]", i)
+				add(&graph.Stage{
+					Name:  name,
+					After: prev,
+					Run: func(ctx context.Context, _ []string) (string, error) {
+						return "", r.runInterceptorAt(ctx, i)
+					},
+				})
+				prev = []string{name}
+			}
+		}
+	)
+	addInterceptorsAt(isolated)
+	if len(r.Interceptor) > 0 {
+		// the other interceptors and right may affect left
+		prev = append(prev, graphLeft)
+	}
+	addInterceptorsAt(others)
+
+	add(&graph.Stage{
+		Name:  graphRight,
+		After: prev,
+		Run: func(ctx context.Context, _ []string) (string, error) {
+			out, err := r.runRightGenCmd(ctx)
+			if err := errors.Join(err, r.runUndo(ctx)); err != nil {
+				return "", err
+			}
+			return out, nil
+		},
+	})
+	add(&graph.Stage{
+		Name:   graphRightPreprocess,
+		Inputs: []string{graphRight},
+		Run: func(ctx context.Context, inputs []string) (string, error) {
+			return r.runSidePreprocess(ctx, right, inputs[0])
+		},
+	})
+	return g
+}
+
+// graphSides returns the sides of the sources and the transforms of the graph.
+// A transform inherits the side of its input.
+func (r *runner) graphSides(spec *config.Graph) map[string]config.Side {
+	var (
+		stages = make(map[string]*config.GraphStage, len(spec.Stages))
+		sides  = map[string]config.Side{}
+		sideOf func(name string) config.Side
+	)
+	for _, s := range spec.Stages {
+		stages[s.Name] = s
+	}
+	// config.Init ensures that the graph is a DAG
+	sideOf = func(name string) config.Side {
+		if side, ok := sides[name]; ok {
+			return side
+		}
+		var (
+			s    = stages[name]
+			side config.Side
+		)
+		switch {
+		case s.Kind == config.StageTransform:
+			side = sideOf(s.Inputs[0])
+			side.Preprocess = s.Commands
+		case s.Side == "left":
+			side = r.GetLeft()
+			side.Preprocess = nil
+		case s.Side == "right":
+			side = r.GetRight()
+			side.Preprocess = nil
+		default:
+			side = config.Side{
+				Args: s.Args,
+			}
+		}
+		side.Name = s.Name
+		sides[name] = side
+		return side
+	}
+	for _, s := range spec.Stages {
+		if s.Kind == config.StageSource || s.Kind == config.StageTransform {
+			_ = sideOf(s.Name)
+		}
+	}
+	return sides
+}
+
+type graphResult struct {
+	name        string
+	left, right string
+	err         error
+}
+
+// runGraph runs the stages of the graph file.
+//
+// A stage starts as soon as its inputs are ready.
+// The differs do not stop the other stages when the outputs differ,
+// the result is the first error other than diffs found or the first diffs found.
+func (r *runner) runGraph(ctx context.Context, spec *config.Graph) error {
+	var (
+		g     = graph.New()
+		sides = r.graphSides(spec)
+		// the differs and the reporters share the Writer
+		mu      sync.Mutex
+		results []*graphResult
+		differs int
+	)
+	for _, s := range spec.Stages {
+		if s.Kind == config.StageDiffer {
+			differs++
+		}
+	}
+
+	for _, s := range spec.Stages {
+		x := &graph.Stage{
+			Name:   s.Name,
+			Inputs: s.Inputs,
+			After:  s.After,
+		}
+		switch s.Kind {
+		case config.StageSource:
+			x.Run = func(ctx context.Context, _ []string) (string, error) {
+				return r.runGenCmd(ctx, sides[s.Name])
+			}
+		case config.StageTransform:
+			x.Run = func(ctx context.Context, inputs []string) (string, error) {
+				return r.runPreprocess(ctx, sides[s.Name], inputs[0])
+			}
+		case config.StageHook:
+			x.Run = func(ctx context.Context, _ []string) (string, error) {
+				for i, c := range s.Commands {
+					stage := fmt.Sprintf("%s[%d]", s.Name, i)
+					if err := r.runHook(ctx, stage, "", c); err != nil {
+						return "", fmt.Errorf("%w: run %s", err, stage)
+					}
+				}
+				return "", nil
+			}
+		case config.StageDiffer:
+			result := &graphResult{
+				name:  s.Name,
+				left:  s.Inputs[0],
+				right: s.Inputs[1],
+			}
+			results = append(results, result)
+			x.Run = func(ctx context.Context, inputs []string) (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if differs > 1 && (r.Brief == "" || r.Brief == config.BriefText) {
+					_, _ = fmt.Fprintf(r.Writer, "# %s: %s -> %s\n", result.name, result.left, result.right)
+				}
+				result.err = r.runDiff(ctx, sides[result.left], sides[result.right], inputs[0], inputs[1])
+				switch {
+				case result.err == nil:
+					return graphSame, nil
+				case IsDiffFound(result.err):
+					return graphDiffer, nil
+				default:
+					return "", fmt.Errorf("%w: run %s", result.err, result.name)
+				}
+			}
+		case config.StageReporter:
+			x.Run = func(ctx context.Context, inputs []string) (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				for i, c := range s.Commands {
+					stage := fmt.Sprintf("%s[%d]", s.Name, i)
+					if err := r.runReporter(ctx, stage, c, inputs); err != nil {
+						return "", fmt.Errorf("%w: run %s", err, stage)
+					}
+				}
+				return "", nil
+			}
+		}
+		if err := g.Add(x); err != nil {
+			return err
+		}
+	}
+
+	if _, err := g.Run(ctx); err != nil {
+		return err
+	}
+
+	errs := make([]error, len(results))
+	for i, x := range results {
+		errs[i] = x.err
+	}
+	if differs > 1 && (r.Brief == "" || r.Brief == config.BriefText) {
+		r.writeGraphSummary(results)
+	}
+	return sweepError(errs)
+}
+
+// runReporter runs the reporter with the inputs as the positional parameters.
+func (r *runner) runReporter(ctx context.Context, stage, reporter string, inputs []string) error {
+	ctx, cancel := r.withTimeout(ctx, stage)
+	defer cancel()
+	cmd := execx.NewExecCmd(ctx, r.GracePeriod, r.Shell, append([]string{"-c", reporter, stage}, inputs...)...)
+	cmd.Stdout = r.Writer
+	cmd.Stderr = os.Stderr
+	x := newCmdLog(stageReport, "", 0, cmd.Args)
+	err := timeoutError(ctx, cmd.Run())
+	x.close("", err)
+	r.logC <- x
+	return err
+}
+
+func (r *runner) writeGraphSummary(results []*graphResult) {
+	w := tabwriter.NewWriter(r.Writer, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "# Summary")
+	_, _ = fmt.Fprintln(w, "DIFFER\tLEFT\tRIGHT\tRESULT")
+	for _, x := range results {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", x.name, x.left, x.right, sweepResultString(x.err))
+	}
+	_ = w.Flush()
+}
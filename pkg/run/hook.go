@@ -0,0 +1,60 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+)
+
+// runHooks runs the hooks of the phase sequentially.
+func (r *runner) runHooks(ctx context.Context, phase string) error {
+	for i, h := range r.GetHooks(phase) {
+		stage := fmt.Sprintf("%s hook[%d]", phase, i)
+		if err := r.runHook(ctx, stage, phase, h); err != nil {
+			return fmt.Errorf("%w: run %s", err, stage)
+		}
+	}
+	return nil
+}
+
+// runTeardown runs all the teardown hooks even if some of them fail or ctx is done.
+func (r *runner) runTeardown(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	var errs []error
+	for i, h := range r.GetHooks(config.HookTeardown) {
+		stage := fmt.Sprintf("%s hook[%d]", config.HookTeardown, i)
+		if err := r.runHook(ctx, stage, config.HookTeardown, h); err != nil {
+			errs = append(errs, fmt.Errorf("%w: run %s", err, stage))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *runner) runHook(ctx context.Context, stage, phase, hook string) error {
+	ctx, cancel := r.withTimeout(ctx, stage)
+	defer cancel()
+	cmd := r.newShellExecCmd(ctx, hook)
+	cmd.Stdout = os.Stderr // hook stdout cannot be mixed with diff stdout
+	cmd.Stderr = os.Stderr
+	x := newCmdLog(stageHook, hookSide(phase), 0, cmd.Args)
+	x.phase = phase
+	err := timeoutError(ctx, cmd.Run())
+	x.close("", err)
+	r.logC <- x
+	return err
+}
+
+// hookSide returns the side the hooks of the phase belong to.
+func hookSide(phase string) string {
+	switch phase {
+	case config.HookBeforeLeft:
+		return "left"
+	case config.HookAfterRight:
+		return "right"
+	default:
+		return ""
+	}
+}
@@ -10,26 +10,44 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
-	"time"
 
+	"github.com/berquerant/cmdcomp/pkg/cache"
 	"github.com/berquerant/cmdcomp/pkg/config"
 	"github.com/berquerant/cmdcomp/pkg/execx"
+	"github.com/berquerant/cmdcomp/pkg/shell"
 	"golang.org/x/sync/errgroup"
 )
 
 func Main(c *config.Config) error {
+	// remove the temporary directory even if the run does not start
+	defer c.Close()
 	ctx, stop := signal.NotifyContext(
 		context.Background(),
 		os.Interrupt,
+		syscall.SIGTERM,
 		syscall.SIGPIPE,
 	)
 	defer stop()
+	ctx, cancel := withDeadline(ctx, c.Deadline)
+	defer cancel()
 
 	logC := make(chan *cmdLog, 100)
 	runner := &runner{
 		Config: c,
 		logC:   logC,
 	}
+	// dry run creates no files
+	if c.DryRun != "" {
+		return runner.writePlan()
+	}
+	if c.Cache {
+		runner.cache = cache.New(c.CacheDir)
+	}
+
+	logWriter, err := newCmdLogWriter(c.CmdLogFile, c.TraceFile)
+	if err != nil {
+		return err
+	}
 
 	doneC := make(chan error)
 	go func() {
@@ -42,179 +60,246 @@ func Main(c *config.Config) error {
 		if c.ShowCmdLog {
 			slog.Info("command log", x.intoSlogAttrs()...)
 		}
+		logWriter.write(x)
 	}
 
-	return <-doneC
+	err = <-doneC
+	if closeErr := logWriter.close(); closeErr != nil {
+		return errors.Join(err, closeErr)
+	}
+	return err
 }
 
 // An error from diff command.
 var ErrDiff = errors.New("Diff")
 
+// ErrDiffFound means that cmdcomp found the differences without the diff command.
+var ErrDiffFound = errors.New("DiffFound")
+
+// IsDiffFound returns true if err means that the outputs differ.
+func IsDiffFound(err error) bool {
+	if errors.Is(err, ErrDiffFound) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	return errors.Is(err, ErrDiff) && errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+}
+
 type runner struct {
 	*config.Config
-	logC chan *cmdLog
+	logC  chan *cmdLog
+	cache *cache.Cache
+	// undo is the stack of the undo commands of the succeeded interceptors.
+	undo []*undoAction
 }
 
-type cmdLog struct {
-	args    []string
-	in      string
-	out     string
-	start   time.Time
-	end     time.Time
-	elapsed int64
-	err     string
+func (r *runner) runCmd(ctx context.Context, side string, attempt int, arg ...string) (string, error) {
+	if r.cache != nil {
+		return r.runCmdWithCache(ctx, side, attempt, arg...)
+	}
+	c := r.newCmd(arg...)
+	x := newCmdLog(stageGenerate, side, attempt, arg)
+	out, err := c.Run(ctx)
+	err = timeoutError(ctx, err)
+	x.close(out, err)
+	r.logC <- x
+	return out, err
 }
 
-func (c cmdLog) intoSlogAttrs() []any {
-	xs := []any{}
-	xs = append(xs, slog.String("args", strings.Join(c.args, " ")))
-	if x := c.in; x != "" {
-		xs = append(xs, slog.String("in", x))
-	}
-	if x := c.out; x != "" {
-		xs = append(xs, slog.String("out", x))
+func (r *runner) runCmdWithCache(ctx context.Context, side string, attempt int, arg ...string) (string, error) {
+	x := newCmdLog(stageGenerate, side, attempt, arg)
+	key, err := cache.NewKey(arg, r.CacheEnv, r.CacheFiles)
+	if err != nil {
+		x.close("", err)
+		r.logC <- x
+		return "", err
 	}
-	xs = append(xs, slog.Time("start", c.start))
-	xs = append(xs, slog.Time("end", c.end))
-	xs = append(xs, slog.Int64("elapsed_ms", c.elapsed))
-	if x := c.err; x != "" {
-		xs = append(xs, slog.String("err", x))
+	logger := slog.With(slog.String("hash", key.Hash()))
+	if e, ok, err := r.cache.Get(key); err != nil {
+		logger.Warn("failed to get cache", slog.Any("err", err))
+	} else if ok {
+		logger.Debug("cache hit", slog.String("path", e.Path))
+		x.cache = "hit"
+		x.close(e.Path, nil)
+		r.logC <- x
+		return e.Path, nil
 	}
-	return xs
-}
 
-func newCmdLog(args []string) *cmdLog {
-	return &cmdLog{
-		args:  args,
-		start: time.Now(),
+	x.cache = "miss"
+	out, err := r.newCmd(arg...).Run(ctx)
+	err = timeoutError(ctx, err)
+	x.close(out, err)
+	r.logC <- x
+	if err != nil {
+		return "", err
 	}
+	if _, err := r.cache.Put(key, out); err != nil {
+		logger.Warn("failed to put cache", slog.Any("err", err))
+	}
+	return out, nil
 }
 
-func (c *cmdLog) close(out string, err error) {
-	c.end = time.Now()
-	c.elapsed = c.end.Sub(c.start).Milliseconds()
-	c.out = out
+func (r *runner) runGenCmd(ctx context.Context, side config.Side) (string, error) {
+	slog.Debug(fmt.Sprintf("start run %s", side.Name), slog.Any("args", side.Args))
+	var out string
+	err := r.retry(ctx, side.Name, r.Retry, func(attempt int) error {
+		ctx, cancel := r.withTimeout(ctx, side.Name)
+		defer cancel()
+		var err error
+		if r.stream(side) {
+			out, err = r.runStream(ctx, side, attempt)
+		} else {
+			out, err = r.runCmd(ctx, side.Name, attempt, side.Args...)
+		}
+		return err
+	})
 	if err != nil {
-		c.err = err.Error()
+		if r.stream(side) && !errors.Is(err, execx.ErrStreamSource) {
+			return "", fmt.Errorf("%w: %w: run %s", ErrPreprocess, err, side.Name)
+		}
+		return "", fmt.Errorf("%w: %w: run %s", ErrGenerate, err, side.Name)
 	}
+	slog.Debug(fmt.Sprintf("end run %s", side.Name), slog.String("out", out))
+	return out, nil
 }
 
-func (r *runner) runCmd(ctx context.Context, arg ...string) (string, error) {
-	c := execx.NewCmd(r.TempDir, arg...)
-	x := newCmdLog(arg)
-	out, err := c.Run(ctx)
-	x.close(out, err)
-	r.logC <- x
-	return out, err
+func (r *runner) newCmd(arg ...string) *execx.Cmd {
+	c := execx.NewCmd(r.TempDir, r.GracePeriod, arg...)
+	c.SetLimit(r.outputLimit())
+	return c
 }
 
-func (r *runner) runGenCmd(ctx context.Context, target string, arg ...string) (string, error) {
-	slog.Debug(fmt.Sprintf("start run %s", target), slog.Any("args", arg))
-	out, err := r.runCmd(ctx, arg...)
-	if err != nil {
-		return "", fmt.Errorf("%w: run %s", err, target)
+func (r *runner) outputLimit() execx.Limit {
+	return execx.Limit{
+		Size:     r.MaxOutput,
+		Truncate: r.TruncateOutput,
 	}
-	slog.Debug(fmt.Sprintf("end run %s", target), slog.String("out", out))
-	return out, nil
 }
 
 func (r *runner) newShellCmd(arg ...string) *execx.Cmd {
-	return execx.NewCmd(r.TempDir, append([]string{r.Shell, "-c"}, arg...)...)
+	return r.newCmd(append([]string{r.Shell, "-c"}, arg...)...)
 }
 
-func (r *runner) runInterceptors(ctx context.Context) error {
-	for i, p := range r.Interceptor {
-		logger := slog.With(slog.Int("count", i), slog.String("interceptor", p))
-		logger.Debug("start run interceptor")
-		cmd := exec.CommandContext(ctx, r.Shell, "-c", p)
-		cmd.Stdout = os.Stderr // interceptor stdout cannot be mixed with diff stdout
-		cmd.Stderr = os.Stderr
-		cmd.Env = os.Environ()
-		x := newCmdLog(cmd.Args)
-		err := cmd.Run()
-		x.close("", err)
-		r.logC <- x
-		if err != nil {
-			return fmt.Errorf("%w: run interceptor[%d]", err, i)
+func (r *runner) newShellExecCmd(ctx context.Context, arg string) *execx.ExecCmd {
+	return execx.NewExecCmd(ctx, r.GracePeriod, r.Shell, "-c", arg)
+}
+
+// runInterceptors runs the interceptors sequentially.
+//
+// The left-isolated interceptors run first, concurrently with the left command,
+// and the others wait for leftGenerated to be closed; nil means the left command has finished.
+func (r *runner) runInterceptors(ctx context.Context, leftGenerated <-chan struct{}) error {
+	isolated, others := r.GetInterceptorIndexes()
+	for _, i := range isolated {
+		if err := r.runInterceptorAt(ctx, i); err != nil {
+			return err
+		}
+	}
+	if leftGenerated != nil {
+		select {
+		case <-leftGenerated:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	for _, i := range others {
+		if err := r.runInterceptorAt(ctx, i); err != nil {
+			return err
 		}
-		slog.Debug("end run interceptor")
 	}
 	return nil
 }
 
+func (r *runner) runInterceptorAt(ctx context.Context, i int) error {
+	p := r.Interceptor[i]
+	logger := slog.With(slog.Int("count", i), slog.String("interceptor", p))
+	logger.Debug("start run interceptor")
+	stage := fmt.Sprintf("interceptor[%d]", i)
+	if err := r.retry(ctx, stage, r.RetryInterceptor, func(attempt int) error {
+		return r.runInterceptor(ctx, stage, p, attempt)
+	}); err != nil {
+		return fmt.Errorf("%w: run %s", err, stage)
+	}
+	r.pushUndo(i)
+	logger.Debug("end run interceptor")
+	return nil
+}
+
+func (r *runner) runInterceptor(ctx context.Context, stage, interceptor string, attempt int) error {
+	ctx, cancel := r.withTimeout(ctx, stage)
+	defer cancel()
+	cmd := r.newShellExecCmd(ctx, interceptor)
+	cmd.Stdout = os.Stderr // interceptor stdout cannot be mixed with diff stdout
+	cmd.Stderr = os.Stderr
+	x := newCmdLog(stageInterceptor, "", attempt, cmd.Args)
+	err := timeoutError(ctx, cmd.Run())
+	x.close("", err)
+	r.logC <- x
+	return err
+}
+
 func (r *runner) runLeftGenCmd(ctx context.Context) (string, error) {
-	return r.runGenCmd(ctx, "left", r.GetLeftArgs()...)
+	if err := r.runHooks(ctx, config.HookBeforeLeft); err != nil {
+		return "", err
+	}
+	return r.runGenCmd(ctx, r.GetLeft())
 }
 
 func (r *runner) runRightGenCmd(ctx context.Context) (string, error) {
-	return r.runGenCmd(ctx, "right", r.GetRightArgs()...)
+	out, err := r.runGenCmd(ctx, r.GetRight())
+	if err != nil {
+		return "", err
+	}
+	if err := r.runHooks(ctx, config.HookAfterRight); err != nil {
+		return "", err
+	}
+	return out, nil
 }
 
 type cmdResult struct {
 	leftOut, rightOut string
 }
 
-func (r *runner) runGenCmdsConcurrently(ctx context.Context) (*cmdResult, error) {
-	var (
-		leftOut, rightOut string
-		eg, _             = errgroup.WithContext(ctx)
-	)
-	eg.Go(func() error {
-		out, err := r.runLeftGenCmd(ctx)
-		if err != nil {
-			return err
-		}
-		leftOut = out
-		return nil
-	})
-	eg.Go(func() error {
-		out, err := r.runRightGenCmd(ctx)
-		if err != nil {
-			return err
-		}
-		rightOut = out
-		return nil
-	})
-	if err := eg.Wait(); err != nil {
-		return nil, err
+// runSidePreprocess runs the preprocess of the side unless it has been streamed.
+func (r *runner) runSidePreprocess(ctx context.Context, side config.Side, out string) (string, error) {
+	if len(side.Preprocess) == 0 || r.stream(side) {
+		return out, nil
 	}
-
-	return &cmdResult{
-		leftOut:  leftOut,
-		rightOut: rightOut,
-	}, nil
+	return r.runPreprocess(ctx, side, out)
 }
 
-func (r *runner) runGenCmdsWithInterceptor(ctx context.Context) (*cmdResult, error) {
-	var (
-		leftOut, rightOut string
-		err               error
-	)
-	if leftOut, err = r.runLeftGenCmd(ctx); err != nil {
-		return nil, err
-	}
-	if err := r.runInterceptors(ctx); err != nil {
-		return nil, err
+func (r *runner) runLeftSide(ctx context.Context) (string, error) {
+	out, err := r.runLeftGenCmd(ctx)
+	if err != nil {
+		return "", err
 	}
-	if rightOut, err = r.runRightGenCmd(ctx); err != nil {
-		return nil, err
+	return r.runSidePreprocess(ctx, r.GetLeft(), out)
+}
+
+func (r *runner) runRightSide(ctx context.Context) (string, error) {
+	out, err := r.runRightGenCmd(ctx)
+	if err != nil {
+		return "", err
 	}
-	return &cmdResult{
-		leftOut:  leftOut,
-		rightOut: rightOut,
-	}, nil
+	return r.runSidePreprocess(ctx, r.GetRight(), out)
 }
 
-func (r *runner) runGenCmds(ctx context.Context) (*cmdResult, error) {
-	if len(r.Interceptor) > 0 {
-		return r.runGenCmdsWithInterceptor(ctx)
+// runSides runs the commands and the preprocess of the sides as the default graph.
+// The preprocess of each side starts as soon as the output of the side is ready.
+func (r *runner) runSides(ctx context.Context) (*cmdResult, error) {
+	outs, err := r.newDefaultGraph().Run(ctx)
+	if err != nil {
+		return nil, errors.Join(err, r.runUndo(ctx))
 	}
-	return r.runGenCmdsConcurrently(ctx)
+	return &cmdResult{
+		leftOut:  outs[graphLeftPreprocess],
+		rightOut: outs[graphRightPreprocess],
+	}, nil
 }
 
-func (r *runner) newPreprocessCmds() []*execx.Cmd {
-	xs := make([]*execx.Cmd, len(r.Preprocess))
-	for i, p := range r.Preprocess {
+func (r *runner) newPreprocessCmds(preprocess []string) []*execx.Cmd {
+	xs := make([]*execx.Cmd, len(preprocess))
+	for i, p := range preprocess {
 		logger := slog.With(slog.Int("count", i), slog.String("preprocess", p))
 		logger.Debug("preprocess")
 		xs[i] = r.newShellCmd(p)
@@ -222,37 +307,54 @@ func (r *runner) newPreprocessCmds() []*execx.Cmd {
 	return xs
 }
 
-func (r *runner) runPreprocess(ctx context.Context, target, input string) (string, error) {
+func (r *runner) runPreprocess(ctx context.Context, side config.Side, input string) (string, error) {
+	target := side.Name
 	slog.Debug(fmt.Sprintf("start %s preprocess", target), slog.String("in", input))
+	var (
+		stage = target + " preprocess"
+		out   string
+	)
+	err := r.retry(ctx, stage, r.RetryPreprocess, func(attempt int) error {
+		var err error
+		out, err = r.runPreprocessPipeline(ctx, stage, side, input, attempt)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %w: run %s preprocess", ErrPreprocess, err, target)
+	}
+	slog.Debug(fmt.Sprintf("end %s preprocess", target), slog.String("out", out))
+	return out, nil
+}
+
+func (r *runner) runPreprocessPipeline(ctx context.Context, stage string, side config.Side, input string, attempt int) (string, error) {
 	stdin, err := os.Open(input)
 	if err != nil {
-		return "", fmt.Errorf("%w: run %s preprocess", err, target)
+		return "", err
 	}
 	defer stdin.Close()
-	cmds := r.newPreprocessCmds()
+	ctx, cancel := r.withTimeout(ctx, stage)
+	defer cancel()
+	cmds := r.newPreprocessCmds(side.Preprocess)
 	p := execx.NewPipedCmd(ctx, r.TempDir, stdin, cmds...)
+	p.SetLimit(r.outputLimit())
 	logs := make([]*cmdLog, len(cmds))
 	for i, x := range cmds {
 		v, _ := x.IntoExecCmd(ctx)
-		logs[i] = newCmdLog(v.Args)
+		logs[i] = newCmdLog(stagePreprocess, side.Name, attempt, v.Args)
 	}
 	logs[0].in = input
-	err = p.Run(ctx)
+	err = timeoutError(ctx, p.Run(ctx))
 	for _, x := range logs {
 		x.close(p.Path(), err)
 	}
 	for _, x := range logs {
 		r.logC <- x
 	}
-	if err != nil {
-		return "", fmt.Errorf("%w: run %s preprocess", err, target)
-	}
-	slog.Debug(fmt.Sprintf("end %s preprocess", target), slog.String("out", p.Path()))
-	return p.Path(), nil
+	return p.Path(), err
 }
 
 func (r *runner) runPreprocesses(ctx context.Context, left, right string) (*cmdResult, error) {
-	if len(r.Preprocess) == 0 {
+	if len(r.Preprocess) == 0 || r.Stream {
 		return &cmdResult{
 			leftOut:  left,
 			rightOut: right,
@@ -261,10 +363,10 @@ func (r *runner) runPreprocesses(ctx context.Context, left, right string) (*cmdR
 
 	var (
 		leftOut, rightOut string
-		eg, _             = errgroup.WithContext(ctx)
+		eg, egCtx         = errgroup.WithContext(ctx)
 	)
 	eg.Go(func() error {
-		out, err := r.runPreprocess(ctx, "left", left)
+		out, err := r.runPreprocess(egCtx, r.GetLeft(), left)
 		if err != nil {
 			return err
 		}
@@ -272,7 +374,7 @@ func (r *runner) runPreprocesses(ctx context.Context, left, right string) (*cmdR
 		return nil
 	})
 	eg.Go(func() error {
-		out, err := r.runPreprocess(ctx, "right", right)
+		out, err := r.runPreprocess(egCtx, r.GetRight(), right)
 		if err != nil {
 			return err
 		}
@@ -288,29 +390,100 @@ func (r *runner) runPreprocesses(ctx context.Context, left, right string) (*cmdR
 	}, nil
 }
 
-func (r *runner) newRunDiffArgument(left, right string) []string {
+func (r *runner) newRunDiffArgument(leftSide, rightSide config.Side, left, right string) ([]string, error) {
 	xs := []string{
-		r.Diff,
+		r.GetDiff(),
 		left,
 		right,
 	}
-	if r.UseLabel {
-		// use '___' to join the arguments.
-		// since they are passed as bash -c, using ' ' delimiters makes correct escaping complicated
-		xs = append(xs, "--label", strings.Join(r.GetLeftArgs(), "___"))
-		xs = append(xs, "--label", strings.Join(r.GetRightArgs(), "___"))
+	if !r.UseLabel {
+		return xs, nil
 	}
-	return xs
+	leftLabel, rightLabel, ok, err := r.GetLabels(leftSide, rightSide)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		xs = append(xs, "--label", shell.Quote(leftLabel))
+		xs = append(xs, "--label", shell.Quote(rightLabel))
+		return xs, nil
+	}
+	// use '___' to join the arguments.
+	// since they are passed as bash -c, using ' ' delimiters makes correct escaping complicated
+	xs = append(xs, "--label", strings.Join(leftSide.Args, "___"))
+	xs = append(xs, "--label", strings.Join(rightSide.Args, "___"))
+	return xs, nil
 }
 
-func (r *runner) runDiff(ctx context.Context, left, right string) error {
-	cmd := exec.CommandContext(ctx, r.Shell, "-c", strings.Join(r.newRunDiffArgument(left, right), " "))
+// sideLabels returns the labels of the sides written by cmdcomp itself,
+// the names of the sides unless the labels are customized.
+func (r *runner) sideLabels(leftSide, rightSide config.Side) (string, string, error) {
+	leftLabel, rightLabel, ok, err := r.GetLabels(leftSide, rightSide)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return leftSide.Name, rightSide.Name, nil
+	}
+	return leftLabel, rightLabel, nil
+}
+
+// newExecDiffArgument returns the argv of the diff command executed without shell.
+// The default labels are the command lines of the sides.
+func (r *runner) newExecDiffArgument(leftSide, rightSide config.Side, left, right string) ([]string, error) {
+	diff, err := r.GetDiffArgs()
+	if err != nil {
+		return nil, err
+	}
+	xs := append(diff, left, right)
+	if !r.UseLabel {
+		return xs, nil
+	}
+	leftLabel, rightLabel, ok, err := r.GetLabels(leftSide, rightSide)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		leftLabel, rightLabel = shell.Join(leftSide.Args), shell.Join(rightSide.Args)
+	}
+	return append(xs, "--label", leftLabel, "--label", rightLabel), nil
+}
+
+// newDiffCmdArgs returns the argv of the diff command.
+func (r *runner) newDiffCmdArgs(leftSide, rightSide config.Side, left, right string) ([]string, error) {
+	if r.DiffExec {
+		return r.newExecDiffArgument(leftSide, rightSide, left, right)
+	}
+	xs, err := r.newRunDiffArgument(leftSide, rightSide, left, right)
+	if err != nil {
+		return nil, err
+	}
+	return []string{r.Shell, "-c", strings.Join(xs, " ")}, nil
+}
+
+func (r *runner) runDiff(ctx context.Context, leftSide, rightSide config.Side, left, right string) error {
+	if r.Brief != "" {
+		return r.compareHash(leftSide, rightSide, left, right)
+	}
+	left, right, done, err := r.compareBinary(leftSide, rightSide, left, right)
+	if done || err != nil {
+		return err
+	}
+	if f, ok := r.Writer.(*os.File); ok && r.TUI && isTerminal(f) {
+		return r.runTUI(ctx, f, leftSide, rightSide, left, right)
+	}
+	ctx, cancel := r.withTimeout(ctx, "diff")
+	defer cancel()
+	args, err := r.newDiffCmdArgs(leftSide, rightSide, left, right)
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	cmd := execx.NewExecCmd(ctx, r.GracePeriod, args[0], args[1:]...)
 	slog.Debug("start run diff", slog.Any("cmd", cmd.Args))
 	cmd.Stdout = r.Writer
 	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
-	x := newCmdLog(cmd.Args)
-	err := cmd.Run()
+	x := newCmdLog(stageDiff, "", 0, cmd.Args)
+	err = timeoutError(ctx, cmd.Run())
 	x.close("", err)
 	r.logC <- x
 	if err != nil {
@@ -320,18 +493,46 @@ func (r *runner) runDiff(ctx context.Context, left, right string) error {
 	return err
 }
 
-func (r *runner) run(ctx context.Context) error {
-	defer r.Close()
-
-	result, err := r.runGenCmds(ctx)
-	if err != nil {
+func (r *runner) run(ctx context.Context) (retErr error) {
+	defer func() {
+		// undo the interceptors remaining on error or interrupt before teardown
+		if err := errors.Join(r.runUndo(ctx), r.runTeardown(ctx)); err != nil {
+			retErr = errors.Join(retErr, &cleanupError{err: err})
+		}
+	}()
+	if err := r.runHooks(ctx, config.HookSetup); err != nil {
 		return err
 	}
 
-	result, err = r.runPreprocesses(ctx, result.leftOut, result.rightOut)
+	if g := r.GetGraph(); g != nil {
+		return r.runGraph(ctx, g)
+	}
+	if r.Sweep != "" {
+		return r.runSweep(ctx)
+	}
+	if len(r.Watch) > 0 {
+		return r.runWatch(ctx)
+	}
+
+	var (
+		result *cmdResult
+		err    error
+	)
+	if r.Bench > 0 {
+		result, err = r.runBench(ctx)
+		if err != nil {
+			return err
+		}
+		if r.BenchOnly {
+			return nil
+		}
+		result, err = r.runPreprocesses(ctx, result.leftOut, result.rightOut)
+	} else {
+		result, err = r.runSides(ctx)
+	}
 	if err != nil {
 		return err
 	}
 
-	return r.runDiff(ctx, result.leftOut, result.rightOut)
+	return r.runDiff(ctx, r.GetLeft(), r.GetRight(), result.leftOut, result.rightOut)
 }
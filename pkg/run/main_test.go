@@ -2,11 +2,14 @@ package run_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/berquerant/cmdcomp/pkg/config"
 	"github.com/berquerant/cmdcomp/pkg/run"
@@ -47,6 +50,726 @@ func TestMain(t *testing.T) {
 `, stdout.String())
 	})
 
+	t.Run("cache", func(t *testing.T) {
+		var (
+			count    = filepath.Join(t.TempDir(), "count")
+			cacheDir = t.TempDir()
+		)
+		runOnce := func() string {
+			var stdout bytes.Buffer
+			c := config.NewConfig(&stdout, nil, nil, "diff", "bash", "--", false)
+			c.Cache = true
+			c.CacheDir = cacheDir
+			c.WorkDir = t.TempDir()
+			assert.Nil(t, c.Init([]string{
+				"bash", "-c", "--", "echo x >> " + count + "; echo a", "--", "echo b",
+			}))
+			err := run.Main(c)
+			assert.ErrorContains(t, err, "exit status 1")
+			return stdout.String()
+		}
+		const want = `1c1
+< a
+---
+> b
+`
+		assert.Equal(t, want, runOnce())
+		assert.Equal(t, want, runOnce())
+		b, err := os.ReadFile(count)
+		assert.Nil(t, err)
+		assert.Equal(t, "x\n", string(b), "the left command should be executed once")
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		flag := filepath.Join(t.TempDir(), "flag")
+		var stdout bytes.Buffer
+		c := config.NewConfig(&stdout, []string{
+			"test -f " + flag + ".i || { touch " + flag + ".i; exit 3; }",
+		}, []string{
+			"test -f " + flag + ".p || { touch " + flag + ".p; exit 4; }; cat",
+		}, "diff", "bash", "--", false)
+		c.Retry = 1
+		c.RetryPreprocess = 1
+		c.RetryInterceptor = 1
+		c.RetryBackoff = time.Millisecond
+		c.WorkDir = t.TempDir()
+		assert.Nil(t, c.Init([]string{
+			"bash", "-c", "--", "test -f " + flag + " || { touch " + flag + "; exit 2; }; echo a", "--", "echo b",
+		}))
+		err := run.Main(c)
+		assert.ErrorContains(t, err, "exit status 1")
+		assert.Equal(t, `1c1
+< a
+---
+> b
+`, stdout.String())
+	})
+
+	t.Run("remove temp dir on error", func(t *testing.T) {
+		t.Run("cmdLogFile", func(t *testing.T) {
+			c := config.NewConfig(&bytes.Buffer{}, nil, nil, "diff", "bash", "--", false)
+			c.CmdLogFile = filepath.Join(t.TempDir(), "none", "cmdlog.jsonl")
+			assert.Nil(t, c.Init([]string{"echo", "--", "a", "--", "b"}))
+			assert.DirExists(t, c.TempDir)
+			assert.NotNil(t, run.Main(c))
+			assert.NoDirExists(t, c.TempDir)
+		})
+		t.Run("init", func(t *testing.T) {
+			c := config.NewConfig(&bytes.Buffer{}, nil, nil, "diff", "bash", "--", false)
+			c.InterceptorUndo = []string{"true"}
+			assert.ErrorIs(t, c.Init([]string{"echo", "--", "a", "--", "b"}), config.ErrConfig)
+			assert.NotEqual(t, "", c.TempDir)
+			assert.NoDirExists(t, c.TempDir)
+		})
+	})
+
+	t.Run("cmdLogFile", func(t *testing.T) {
+		var (
+			dir        = t.TempDir()
+			cmdLogFile = filepath.Join(dir, "cmdlog.jsonl")
+			traceFile  = filepath.Join(dir, "trace.json")
+		)
+		c := config.NewConfig(&bytes.Buffer{}, nil, []string{"cat"}, "diff", "bash", "--", false)
+		c.CmdLogFile = cmdLogFile
+		c.TraceFile = traceFile
+		c.WorkDir = t.TempDir()
+		assert.Nil(t, c.Init([]string{"echo", "--", "a", "--", "b"}))
+		assert.ErrorContains(t, run.Main(c), "exit status 1")
+
+		f, err := os.Open(cmdLogFile)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer f.Close()
+		type entry struct {
+			Stage    string `json:"stage"`
+			Side     string `json:"side"`
+			ExitCode int    `json:"exit_code"`
+		}
+		got := map[entry]int{}
+		dec := json.NewDecoder(f)
+		for dec.More() {
+			var e entry
+			assert.Nil(t, dec.Decode(&e))
+			got[e]++
+		}
+		assert.Equal(t, map[entry]int{
+			{Stage: "generate", Side: "left"}:    1,
+			{Stage: "generate", Side: "right"}:   1,
+			{Stage: "preprocess", Side: "left"}:  1,
+			{Stage: "preprocess", Side: "right"}: 1,
+			{Stage: "diff", ExitCode: 1}:         1,
+		}, got)
+
+		b, err := os.ReadFile(traceFile)
+		assert.Nil(t, err)
+		var trace struct {
+			TraceEvents []struct {
+				Cat string `json:"cat"`
+				Ph  string `json:"ph"`
+				Tid int    `json:"tid"`
+			} `json:"traceEvents"`
+		}
+		assert.Nil(t, json.Unmarshal(b, &trace))
+		assert.Len(t, trace.TraceEvents, 5)
+	})
+
+	t.Run("bench", func(t *testing.T) {
+		for _, tc := range []struct {
+			title       string
+			interceptor []string
+			benchOnly   bool
+			diff        bool
+		}{
+			{
+				title: "with diff",
+				diff:  true,
+			},
+			{
+				title:     "bench only",
+				benchOnly: true,
+			},
+			{
+				title:       "with interceptor",
+				interceptor: []string{"true"},
+				diff:        true,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var (
+					stdout     bytes.Buffer
+					cmdLogFile = filepath.Join(t.TempDir(), "cmdlog.jsonl")
+				)
+				c := config.NewConfig(&stdout, tc.interceptor, nil, "diff", "bash", "--", false)
+				c.Bench = 3
+				c.BenchOnly = tc.benchOnly
+				c.CmdLogFile = cmdLogFile
+				c.WorkDir = t.TempDir()
+				assert.Nil(t, c.Init([]string{"echo", "--", "a", "--", "b"}))
+				err := run.Main(c)
+				got := stdout.String()
+				if tc.diff {
+					assert.ErrorContains(t, err, "exit status 1")
+					assert.Equal(t, "1c1\n< a\n---\n> b\n", got, "the benchmark should be written to stderr")
+				} else {
+					assert.Nil(t, err)
+					assert.Contains(t, got, "# Benchmark (3 runs)")
+					assert.Contains(t, got, "wall_ms")
+					assert.NotContains(t, got, "1c1")
+				}
+				b, err := os.ReadFile(cmdLogFile)
+				assert.Nil(t, err)
+				assert.Equal(t, 6, bytes.Count(b, []byte(`"stage":"generate"`)))
+			})
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		for _, tc := range []struct {
+			title       string
+			format      string
+			interceptor []string
+			preprocess  []string
+			want        string
+		}{
+			{
+				title:  "text",
+				format: config.DryRunText,
+				want: `mode: compare
+execution: left and right run concurrently
+left: touch FILE a
+right: touch FILE 'b c'
+diff: bash -c 'diff LEFT_FILE RIGHT_FILE'
+`,
+			},
+			{
+				title:       "text with interceptor and preprocess",
+				format:      config.DryRunText,
+				interceptor: []string{"touch FILE"},
+				preprocess:  []string{"sed 's|a|b|'", "cat"},
+				want: `mode: compare
+execution: left, the interceptors and right run sequentially; left preprocess starts as soon as left finishes
+left: touch FILE a | bash -c 'sed '\''s|a|b|'\''' | bash -c cat
+right: touch FILE 'b c' | bash -c 'sed '\''s|a|b|'\''' | bash -c cat
+interceptor[0]: bash -c 'touch FILE'
+diff: bash -c 'diff LEFT_FILE RIGHT_FILE'
+`,
+			},
+			{
+				title:  "json",
+				format: config.DryRunJSON,
+				want: `{"mode":"compare","concurrent":true,"sides":[{"name":"left","args":["touch","FILE","a"]},{"name":"right","args":["touch","FILE","b c"]}],"diff":["bash","-c","diff LEFT_FILE RIGHT_FILE"]}
+`,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var stdout bytes.Buffer
+				c := config.NewConfig(&stdout, tc.interceptor, tc.preprocess, "diff", "bash", "--", false)
+				c.DryRun = tc.format
+				c.WorkDir = t.TempDir()
+				assert.Nil(t, c.Init([]string{"touch", "FILE", "--", "a", "--", "b c"}))
+				assert.Nil(t, run.Main(c))
+				assert.Equal(t, tc.want, stdout.String())
+				assert.NoFileExists(t, "FILE", "should not execute commands")
+			})
+		}
+
+		t.Run("no files", func(t *testing.T) {
+			var (
+				stdout bytes.Buffer
+				dir    = t.TempDir()
+			)
+			c := config.NewConfig(&stdout, nil, nil, "diff", "bash", "--", false)
+			c.DryRun = config.DryRunText
+			c.Template = true
+			c.CmdLogFile = filepath.Join(dir, "cmdlog.jsonl")
+			c.TraceFile = filepath.Join(dir, "trace.json")
+			assert.Nil(t, c.Init([]string{"cat", "--", "{{.TempDir}}/a", "--", "b"}))
+			assert.Nil(t, run.Main(c))
+			assert.Contains(t, stdout.String(), "left: cat TEMP_DIR/a\n")
+			assert.NoFileExists(t, c.CmdLogFile)
+			assert.NoFileExists(t, c.TraceFile)
+			assert.NoDirExists(t, config.DryRunTempDir)
+		})
+	})
+
+	t.Run("diff exec with spaces in workDir", func(t *testing.T) {
+		var stdout bytes.Buffer
+		c := config.NewConfig(&stdout, nil, nil, "diff", "bash", "--", false)
+		c.DiffExec = true
+		c.WorkDir = filepath.Join(t.TempDir(), "work dir")
+		assert.Nil(t, os.Mkdir(c.WorkDir, 0o755))
+		assert.Nil(t, c.Init([]string{"echo", "--", "a", "--", "b"}))
+		assert.ErrorContains(t, run.Main(c), "exit status 1")
+		assert.Equal(t, `1c1
+< a
+---
+> b
+`, stdout.String())
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var stdout bytes.Buffer
+		c := config.NewConfig(&stdout, nil, []string{`sed 's|a|c|'`, "tr a-z A-Z"}, "diff", "bash", "--", false)
+		c.Stream = true
+		c.WorkDir = t.TempDir()
+		assert.Nil(t, c.Init([]string{"echo", "--", "a", "--", "b"}))
+		assert.ErrorContains(t, run.Main(c), "exit status 1")
+		assert.Equal(t, `1c1
+< C
+---
+> B
+`, stdout.String())
+
+		outs, err := filepath.Glob(filepath.Join(c.WorkDir, "*", "out"))
+		assert.Nil(t, err)
+		var got []string
+		for _, x := range outs {
+			b, err := os.ReadFile(x)
+			assert.Nil(t, err)
+			got = append(got, string(b))
+		}
+		assert.ElementsMatch(t, []string{"a\n", "b\n", "C\n", "B\n"}, got, "workDir should keep the outputs of the commands")
+	})
+
+	t.Run("stream preprocess exits early", func(t *testing.T) {
+		for _, workDir := range []bool{false, true} {
+			t.Run(fmt.Sprintf("workDir %v", workDir), func(t *testing.T) {
+				for range 10 {
+					var stdout bytes.Buffer
+					c := config.NewConfig(&stdout, nil, []string{"head -n1"}, "diff", "bash", "--", false)
+					c.Stream = true
+					if workDir {
+						c.WorkDir = t.TempDir()
+					}
+					assert.Nil(t, c.Init([]string{"seq", "--", "1", "100000", "--", "1", "100001"}))
+					assert.Nil(t, run.Main(c), "the source killed by SIGPIPE should not fail")
+					assert.Equal(t, "", stdout.String())
+				}
+			})
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		var (
+			dir        = t.TempDir()
+			leftFile   = filepath.Join(dir, "left.txt")
+			rightFile  = filepath.Join(dir, "right.txt")
+			cmdLogFile = filepath.Join(t.TempDir(), "cmdlog.jsonl")
+			stdout     bytes.Buffer
+		)
+		assert.Nil(t, os.WriteFile(leftFile, []byte("a\n"), 0o644))
+		assert.Nil(t, os.WriteFile(rightFile, []byte("b\n"), 0o644))
+		c := config.NewConfig(&stdout, nil, nil, "diff", "bash", "--", false)
+		c.Watch = []string{dir}
+		c.WatchInterval = 10 * time.Millisecond
+		c.WatchDebounce = 20 * time.Millisecond
+		c.Deadline = time.Second
+		c.CmdLogFile = cmdLogFile
+		c.WorkDir = t.TempDir()
+		assert.Nil(t, c.Init([]string{"cat", "--", leftFile, "--", rightFile}))
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			_ = os.WriteFile(leftFile, []byte("c\n"), 0o644)
+		}()
+		assert.ErrorIs(t, run.Main(c), run.ErrTimeout)
+		assert.Equal(t, `1c1
+< a
+---
+> b
+1c1
+< c
+---
+> b
+`, stdout.String())
+
+		b, err := os.ReadFile(cmdLogFile)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, bytes.Count(b, []byte(`"stage":"generate","side":"left"`)))
+		assert.Equal(t, 1, bytes.Count(b, []byte(`"stage":"generate","side":"right"`)), "right should not rerun")
+	})
+
+	t.Run("hooks", func(t *testing.T) {
+		for _, tc := range []struct {
+			title       string
+			hooks       []string
+			interceptor []string
+			deadline    time.Duration
+			args        []string
+			want        string
+			errMsg      string
+		}{
+			{
+				title: "phases",
+				hooks: []string{
+					"teardown=echo teardown >> $OUT",
+					"afterRight=echo afterRight >> $OUT",
+					"setup=echo setup >> $OUT",
+					"beforeLeft=echo beforeLeft >> $OUT",
+				},
+				interceptor: []string{"echo interceptor >> $OUT"},
+				args:        []string{"echo", "--", "a", "--", "b"},
+				want: `setup
+beforeLeft
+interceptor
+afterRight
+teardown
+`,
+				errMsg: "exit status 1",
+			},
+			{
+				title: "teardown on failure",
+				hooks: []string{
+					"setup=echo setup >> $OUT; exit 3",
+					"teardown=echo teardown1 >> $OUT; exit 4",
+					"teardown=echo teardown2 >> $OUT",
+				},
+				args: []string{"echo", "--", "a", "--", "b"},
+				want: `setup
+teardown1
+teardown2
+`,
+				errMsg: "exit status 3: run setup hook[0]\nexit status 4: run teardown hook[0]",
+			},
+			{
+				title:    "teardown on deadline",
+				hooks:    []string{"teardown=echo teardown >> $OUT"},
+				deadline: 200 * time.Millisecond,
+				args:     []string{"bash", "-c", "--", "sleep 10", "--", "echo b"},
+				want:     "teardown\n",
+				errMsg:   "deadline 200ms exceeded",
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var (
+					dir        = t.TempDir()
+					out        = filepath.Join(dir, "out")
+					cmdLogFile = filepath.Join(dir, "cmdlog.jsonl")
+				)
+				t.Setenv("OUT", out)
+				c := config.NewConfig(&bytes.Buffer{}, tc.interceptor, nil, "diff", "bash", "--", false)
+				c.Hooks = tc.hooks
+				c.Deadline = tc.deadline
+				c.CmdLogFile = cmdLogFile
+				c.WorkDir = t.TempDir()
+				assert.Nil(t, c.Init(tc.args))
+				assert.ErrorContains(t, run.Main(c), tc.errMsg)
+				got, err := os.ReadFile(out)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, string(got))
+				b, err := os.ReadFile(cmdLogFile)
+				assert.Nil(t, err)
+				assert.Contains(t, string(b), `"stage":"hook","phase":"teardown"`)
+			})
+		}
+	})
+
+	t.Run("undo", func(t *testing.T) {
+		for _, tc := range []struct {
+			title       string
+			interceptor []string
+			undo        []string
+			right       string
+			want        string
+			errMsg      string
+		}{
+			{
+				title:       "after right",
+				interceptor: []string{"echo i0 >> $OUT", "echo i1 >> $OUT", "echo i2 >> $OUT"},
+				undo:        []string{"echo u0 >> $OUT", "", "echo u2 >> $OUT"},
+				right:       "echo right >> $OUT",
+				want:        "left\ni0\ni1\ni2\nright\nu2\nu0\n",
+			},
+			{
+				title:       "interceptor failure",
+				interceptor: []string{"echo i0 >> $OUT", "echo i1 >> $OUT; exit 2"},
+				undo:        []string{"echo u0 >> $OUT", "echo u1 >> $OUT"},
+				right:       "echo right >> $OUT",
+				want:        "left\ni0\ni1\nu0\n",
+				errMsg:      "exit status 2: run interceptor[1]",
+			},
+			{
+				title:       "right failure",
+				interceptor: []string{"echo i0 >> $OUT"},
+				undo:        []string{"echo u0 >> $OUT; exit 3"},
+				right:       "echo right >> $OUT; exit 2",
+				want:        "left\ni0\nright\nu0\n",
+				errMsg:      "exit status 2: run right\nexit status 3: run interceptor[0] undo",
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				out := filepath.Join(t.TempDir(), "out")
+				t.Setenv("OUT", out)
+				c := config.NewConfig(&bytes.Buffer{}, tc.interceptor, nil, "diff", "bash", "--", false)
+				c.InterceptorUndo = tc.undo
+				c.WorkDir = t.TempDir()
+				assert.Nil(t, c.Init([]string{"bash", "-c", "--", "echo left >> $OUT", "--", tc.right}))
+				err := run.Main(c)
+				if tc.errMsg != "" {
+					assert.ErrorContains(t, err, tc.errMsg)
+				} else {
+					assert.Nil(t, err)
+				}
+				got, err := os.ReadFile(out)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, string(got))
+			})
+		}
+	})
+
+	t.Run("left isolated", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		t.Setenv("OUT", out)
+		c := config.NewConfig(&bytes.Buffer{}, []string{
+			"sleep 0.3; echo other >> $OUT",
+			"echo isolated >> $OUT",
+		}, []string{"tee -a $OUT"}, "diff", "bash", "--", false)
+		c.LeftIsolated = []int{1}
+		c.WorkDir = t.TempDir()
+		assert.Nil(t, c.Init([]string{"bash", "-c", "--", "sleep 0.3; echo left >> $OUT; echo L", "--", "echo R"}))
+		assert.ErrorContains(t, run.Main(c), "exit status 1")
+		got, err := os.ReadFile(out)
+		assert.Nil(t, err)
+		assert.Equal(t, "isolated\nleft\nL\nother\nR\n", string(got), "left preprocess should not wait for the interceptors")
+	})
+
+	t.Run("cancel sibling", func(t *testing.T) {
+		c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+		c.GracePeriod = 100 * time.Millisecond
+		c.WorkDir = t.TempDir()
+		assert.Nil(t, c.Init([]string{
+			"bash", "-c", "--", "sleep 0.1; exit 2", "--", "sleep 10 & wait",
+		}))
+		start := time.Now()
+		err := run.Main(c)
+		assert.ErrorContains(t, err, "exit status 2: run left")
+		assert.Less(t, time.Since(start), 5*time.Second, "the right command should be canceled")
+	})
+
+	t.Run("graph", func(t *testing.T) {
+		writeGraph := func(t *testing.T, stages string) string {
+			t.Helper()
+			p := filepath.Join(t.TempDir(), "graph.json")
+			assert.Nil(t, os.WriteFile(p, []byte(`{"stages": `+stages+`}`), 0o600))
+			return p
+		}
+
+		t.Run("deadline during backoff", func(t *testing.T) {
+			c := config.NewConfig(&bytes.Buffer{}, nil, nil, "diff", "bash", "--", false)
+			c.WorkDir = t.TempDir()
+			c.Deadline = 100 * time.Millisecond
+			c.Retry = 2
+			c.RetryBackoff = 10 * time.Second
+			// the only stage, so that the error of the retries is returned
+			c.GraphFile = writeGraph(t, `[{"name": "left", "kind": "source", "side": "left"}]`)
+			assert.Nil(t, c.Init([]string{"bash", "-c", "--", "exit 2", "--", "echo b"}))
+			err := run.Main(c)
+			assert.ErrorIs(t, err, run.ErrTimeout)
+			assert.ErrorContains(t, err, "Timeout: deadline 100ms exceeded: canceled during backoff after 1 attempt failed: attempt[0]: exit status 2")
+		})
+
+		t.Run("preprocess left twice", func(t *testing.T) {
+			var stdout bytes.Buffer
+			c := config.NewConfig(&stdout, nil, nil, "diff", "bash", "--", false)
+			c.WorkDir = t.TempDir()
+			c.GraphFile = writeGraph(t, `[
+  {"name": "left", "kind": "source", "side": "left"},
+  {"name": "right", "kind": "source", "side": "right"},
+  {"name": "sorted", "kind": "transform", "inputs": ["left"], "commands": ["sort"]},
+  {"name": "reversed", "kind": "transform", "inputs": ["left"], "commands": ["sort -r"]},
+  {"name": "diff sorted", "kind": "differ", "inputs": ["sorted", "right"]},
+  {"name": "diff reversed", "kind": "differ", "inputs": ["reversed", "right"], "after": ["diff sorted"]},
+  {"name": "report", "kind": "reporter", "inputs": ["diff sorted", "diff reversed"], "commands": ["echo \"$0: $1 $2\""]}
+]`)
+			assert.Nil(t, c.Init([]string{"printf", "--", `b\na\n`, "--", `a\nb\n`}))
+			err := run.Main(c)
+			assert.True(t, run.IsDiffFound(err))
+			assert.Equal(t, `# diff sorted: sorted -> right
+# diff reversed: reversed -> right
+1d0
+< b
+2a2
+> b
+report[0]: same differ
+# Summary
+DIFFER         LEFT      RIGHT  RESULT
+diff sorted    sorted    right  same
+diff reversed  reversed  right  differ
+`, stdout.String())
+		})
+
+		t.Run("dry run", func(t *testing.T) {
+			var stdout bytes.Buffer
+			c := config.NewConfig(&stdout, nil, nil, "diff", "bash", "--", false)
+			c.DryRun = config.DryRunText
+			c.WorkDir = t.TempDir()
+			c.GraphFile = writeGraph(t, `[
+  {"name": "diff", "kind": "differ", "inputs": ["upper", "right"]},
+  {"name": "upper", "kind": "transform", "inputs": ["left"], "commands": ["tr a-z A-Z"]},
+  {"name": "left", "kind": "source", "args": ["touch", "FILE"]},
+  {"name": "right", "kind": "source", "side": "right"},
+  {"name": "notify", "kind": "hook", "commands": ["touch FILE"], "after": ["diff"]}
+]`)
+			assert.Nil(t, c.Init([]string{"touch", "FILE", "--", "a", "--", "b"}))
+			assert.Nil(t, run.Main(c))
+			assert.Equal(t, `mode: graph
+execution: each stage starts as soon as its inputs are ready
+stage left (source): touch FILE
+stage right (source): touch FILE b
+stage upper (transform): bash -c 'tr a-z A-Z' <- left
+stage diff (differ): bash -c 'diff upper right' <- upper, right
+stage notify (hook): bash -c 'touch FILE' after diff
+`, stdout.String())
+			assert.NoFileExists(t, "FILE", "should not execute commands")
+		})
+
+		for _, tc := range []struct {
+			title       string
+			stages      string
+			interceptor []string
+			cache       bool
+			want        string
+		}{
+			{
+				title:  "cycle",
+				stages: `[{"name": "a", "kind": "transform", "inputs": ["b"], "commands": ["cat"]}, {"name": "b", "kind": "transform", "inputs": ["a"], "commands": ["cat"]}]`,
+				want:   "cycle in stages a, b",
+			},
+			{
+				title:  "unknown input",
+				stages: `[{"name": "a", "kind": "transform", "inputs": ["x"], "commands": ["cat"]}]`,
+				want:   `stage "a" depends on unknown stage "x"`,
+			},
+			{
+				title:  "differ of differ",
+				stages: `[{"name": "l", "kind": "source", "side": "left"}, {"name": "d", "kind": "differ", "inputs": ["l", "l"]}, {"name": "e", "kind": "differ", "inputs": ["d", "l"]}]`,
+				want:   `differ stage "e" cannot take the output of differ stage "d"`,
+			},
+			{
+				title:  "unknown kind",
+				stages: `[{"name": "a", "kind": "sink"}]`,
+				want:   `stage "a" has unknown kind "sink"`,
+			},
+			{
+				title:       "interceptor",
+				stages:      `[{"name": "l", "kind": "source", "side": "left"}]`,
+				interceptor: []string{"true"},
+				want:        "graph does not support interceptors",
+			},
+			{
+				title:  "cache with hook",
+				stages: `[{"name": "h", "kind": "hook", "commands": ["true"]}]`,
+				cache:  true,
+				want:   "cache does not support hook stages",
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				c := config.NewConfig(&bytes.Buffer{}, tc.interceptor, nil, "diff", "bash", "--", false)
+				c.WorkDir = t.TempDir()
+				c.Cache = tc.cache
+				c.CacheDir = t.TempDir()
+				c.GraphFile = writeGraph(t, tc.stages)
+				err := c.Init([]string{"echo", "--", "a", "--", "b"})
+				assert.ErrorIs(t, err, config.ErrConfig)
+				assert.ErrorContains(t, err, tc.want)
+			})
+		}
+	})
+
+	t.Run("sweep", func(t *testing.T) {
+		for _, tc := range []struct {
+			title   string
+			against string
+			brief   string
+			values  []string
+			want    string
+			errMsg  string
+		}{
+			{
+				title:  "adjacent",
+				values: []string{"a", "a", "b"},
+				want: `# v: a -> a
+# v: a -> b
+1c1
+< a
+---
+> b
+# Summary
+LEFT  RIGHT  RESULT
+a     a      same
+a     b      differ
+`,
+				errMsg: "exit status 1",
+			},
+			{
+				title:   "first",
+				against: config.SweepFirst,
+				values:  []string{"a", "b", "a"},
+				want: `# v: a -> b
+1c1
+< a
+---
+> b
+# v: a -> a
+# Summary
+LEFT  RIGHT  RESULT
+a     b      differ
+a     a      same
+`,
+				errMsg: "exit status 1",
+			},
+			{
+				title:  "brief",
+				brief:  config.BriefText,
+				values: []string{"a", "a", "b"},
+				want: `# v: a -> a
+# v: a -> b
+Outputs a and b differ
+# Summary
+LEFT  RIGHT  RESULT
+a     a      same
+a     b      differ
+`,
+				errMsg: "DiffFound",
+			},
+			{
+				title:  "brief json",
+				brief:  config.BriefJSON,
+				values: []string{"a", "b"},
+				want: `{"same":false,"left":{"name":"a","sha256":"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7","size":2},"right":{"name":"b","sha256":"0263829989b6fd954f72baaf2fc64bc2e2f01d692d4de72986ea808f6e99813f","size":2}}
+`,
+				errMsg: "DiffFound",
+			},
+			{
+				title:  "same",
+				values: []string{"a", "a"},
+				want: `# v: a -> a
+# Summary
+LEFT  RIGHT  RESULT
+a     a      same
+`,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var stdout bytes.Buffer
+				c := config.NewConfig(&stdout, nil, nil, "diff", "bash", "--", false)
+				c.Sweep = "v"
+				c.SweepValues = tc.values
+				c.SweepAgainst = tc.against
+				c.Brief = tc.brief
+				c.WorkDir = t.TempDir()
+				assert.Nil(t, c.Init([]string{"echo", "{{.Vars.v}}"}))
+				err := run.Main(c)
+				if x := tc.errMsg; x != "" {
+					assert.ErrorContains(t, err, x)
+				} else {
+					assert.Nil(t, err)
+				}
+				assert.Equal(t, tc.want, stdout.String())
+			})
+		}
+	})
+
 	for _, tc := range []struct {
 		title   string
 		c       *config.Config
@@ -123,6 +846,231 @@ func TestMain(t *testing.T) {
 < c
 ---
 > b
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "stream",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, []string{`sed 's|a|c|'`}, "diff", "bash", "--", false)
+				c.Stream = true
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "b"},
+			want: `1c1
+< c
+---
+> b
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "stream source failure",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, []string{"cat"}, "diff", "bash", "--", false)
+				c.Stream = true
+				return c
+			}(),
+			args:   []string{"bash", "-c", "--", "exit 2", "--", "echo b"},
+			errMsg: "exit status 2: stream source: run left",
+		},
+		{
+			title: "stream with cache",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, []string{"cat"}, "diff", "bash", "--", false)
+				c.Stream = true
+				c.Cache = true
+				c.CacheDir = os.TempDir()
+				return c
+			}(),
+			args:    []string{"echo", "--", "a", "--", "b"},
+			initErr: true,
+			errMsg:  "stream does not support cache",
+		},
+		{
+			title: "cache with interceptor",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, []string{"true"}, nil, "diff", "bash", "--", false)
+				c.Cache = true
+				c.CacheDir = os.TempDir()
+				return c
+			}(),
+			args:    []string{"echo", "--", "a", "--", "b"},
+			initErr: true,
+			errMsg:  "cache does not support interceptors",
+		},
+		{
+			title: "cache with hook",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.Cache = true
+				c.CacheDir = os.TempDir()
+				c.Hooks = []string{"afterRight=true"}
+				return c
+			}(),
+			args:    []string{"echo", "--", "a", "--", "b"},
+			initErr: true,
+			errMsg:  "cache does not support beforeLeft and afterRight hooks",
+		},
+		{
+			title: "max output",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.MaxOutput = 4
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "bcdef"},
+			errMsg: "OutputTooLarge: exceeded 4 bytes",
+		},
+		{
+			title: "max output of preprocess",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, []string{"sed p"}, "diff", "bash", "--", false)
+				c.MaxOutput = 4
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "bc"},
+			errMsg: "OutputTooLarge: exceeded 4 bytes",
+		},
+		{
+			title: "truncate output",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.MaxOutput = 4
+				c.TruncateOutput = true
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "bcdef"},
+			want: `1c1,2
+< a
+---
+> bcde
+> [cmdcomp: output truncated at 4 bytes]
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "binary checksum",
+			c:     config.NewConfig(nil, nil, nil, "diff", "bash", "--", false),
+			args:  []string{"printf", "--", `a\0`, "--", `b\0`},
+			want: `Binary outputs left and right differ
+< sha256:ffe9aaeaa2a2d5048174df0b80599ef0197ec024c4b051bc9860cff58ef7f9f3 2 bytes
+> sha256:1e57b933b0a78203e21d41cc4b16d731b255b04058d48a4ac2731f0089312129 2 bytes
+`,
+			errMsg: "DiffFound",
+		},
+		{
+			title: "binary checksum with labels",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.LabelFormat = "{{.Side}}: {{.Args | shellquote}}"
+				return c
+			}(),
+			args: []string{"printf", "--", `a\0`, "--", `b\0`},
+			want: `Binary outputs left: printf 'a\0' and right: printf 'b\0' differ
+< sha256:ffe9aaeaa2a2d5048174df0b80599ef0197ec024c4b051bc9860cff58ef7f9f3 2 bytes
+> sha256:1e57b933b0a78203e21d41cc4b16d731b255b04058d48a4ac2731f0089312129 2 bytes
+`,
+			errMsg: "DiffFound",
+		},
+		{
+			title: "binary checksum same",
+			c:     config.NewConfig(nil, nil, nil, "diff", "bash", "--", false),
+			args:  []string{"printf", `a\0`, "--", "--"},
+		},
+		{
+			title: "binary hexdump",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.Binary = config.BinaryHexdump
+				return c
+			}(),
+			args: []string{"printf", "--", `a\0`, "--", `b\0`},
+			want: `1c1
+< 00000000: 6100                                     a.
+---
+> 00000000: 6200                                     b.
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "brief",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "false", "bash", "--", false)
+				c.Brief = config.BriefText
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "b"},
+			want:   "Outputs left and right differ\n",
+			errMsg: "DiffFound",
+		},
+		{
+			title: "brief with labels",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "false", "bash", "--", false)
+				c.Brief = config.BriefText
+				c.LeftLabel = "old"
+				c.RightLabel = "new"
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "b"},
+			want:   "Outputs old and new differ\n",
+			errMsg: "DiffFound",
+		},
+		{
+			title: "brief same",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "false", "bash", "--", false)
+				c.Brief = config.BriefText
+				return c
+			}(),
+			args: []string{"echo", "a", "--", "--"},
+		},
+		{
+			title: "brief json",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "false", "bash", "--", false)
+				c.Brief = config.BriefJSON
+				return c
+			}(),
+			args: []string{"echo", "a", "--", "--"},
+			want: `{"same":true,"left":{"name":"left","sha256":"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7","size":2},"right":{"name":"right","sha256":"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7","size":2}}
+`,
+		},
+		{
+			title: "brief json with labels",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "false", "bash", "--", false)
+				c.Brief = config.BriefJSON
+				c.LabelFormat = "{{.Side}} {{.Name}}"
+				return c
+			}(),
+			args: []string{"echo", "a", "--", "--"},
+			want: `{"same":true,"left":{"name":"left","label":"left left","sha256":"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7","size":2},"right":{"name":"right","label":"right right","sha256":"87428fc522803d31065e7bce3cf03fe475096631e5e07bbd7a0fde60c4cf25c7","size":2}}
+`,
+		},
+		{
+			title: "quiet",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "false", "bash", "--", false)
+				c.Brief = config.BriefQuiet
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "b"},
+			errMsg: "DiffFound",
+		},
+		{
+			title: "tui without terminal",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.TUI = true
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "b"},
+			want: `1c1
+< a
+---
+> b
 `,
 			errMsg: "exit status 1",
 		},
@@ -181,6 +1129,227 @@ func TestMain(t *testing.T) {
 			args:   []string{"echo", "--", "a", "--", "a"},
 			errMsg: "preprocess",
 		},
+		{
+			title: "template side",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.Template = true
+				return c
+			}(),
+			args: []string{"echo", "{{.Side}}", "{{.Index}}"},
+			want: `1c1
+< left 0
+---
+> right 1
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "template vars",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, []string{
+					`sed 's|{{.Vars.from}}|{{.Vars.to}}|'`,
+				}, "diff", "bash", "--", false)
+				c.Vars = []string{"v=a,b", "from=x,b", "to=y,c"}
+				return c
+			}(),
+			args: []string{"echo", "{{.Vars.v}}", "--", "1", "--", "2"},
+			want: `1c1
+< a 1
+---
+> c 2
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "template without vars",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.Template = true
+				return c
+			}(),
+			args:    []string{"echo", "{{.Vars.v}}"},
+			initErr: true,
+			errMsg:  "left args",
+		},
+		{
+			title: "invalid var",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.Vars = []string{"v=a"}
+				return c
+			}(),
+			args:    []string{"echo", "{{.Vars.v}}"},
+			initErr: true,
+			errMsg:  "invalid var",
+		},
+		{
+			title: "invalid label format",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.LabelFormat = "{{.Unknown}}"
+				return c
+			}(),
+			args:    []string{"echo", "--", "a", "--", "b"},
+			initErr: true,
+			errMsg:  "left label",
+		},
+		{
+			title: "left isolated out of interceptors",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, []string{"true"}, nil, "diff", "bash", "--", false)
+				c.LeftIsolated = []int{1}
+				return c
+			}(),
+			args:    []string{"echo", "--", "a", "--", "b"},
+			initErr: true,
+			errMsg:  "leftIsolated 1 out of interceptors",
+		},
+		{
+			title: "left timeout",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.Timeout = 100 * time.Millisecond
+				return c
+			}(),
+			args:   []string{"bash", "-c", "--", "sleep 10 | cat", "--", "echo b"},
+			errMsg: "Timeout: left exceeded 100ms",
+		},
+		{
+			title: "preprocess timeout",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, []string{"sleep 10"}, "diff", "bash", "--", false)
+				c.Timeout = 100 * time.Millisecond
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "b"},
+			errMsg: "preprocess exceeded 100ms",
+		},
+		{
+			title: "interceptor timeout",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, []string{"sleep 10"}, nil, "diff", "bash", "--", false)
+				c.Timeout = 100 * time.Millisecond
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "b"},
+			errMsg: "Timeout: interceptor[0] exceeded 100ms",
+		},
+		{
+			title: "deadline",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "sleep 10; diff", "bash", "--", false)
+				c.Deadline = 100 * time.Millisecond
+				return c
+			}(),
+			args:   []string{"echo", "--", "a", "--", "b"},
+			errMsg: "Timeout: deadline 100ms exceeded",
+		},
+		{
+			title: "retries exhausted",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff", "bash", "--", false)
+				c.Retry = 2
+				c.RetryBackoff = time.Millisecond
+				return c
+			}(),
+			args:   []string{"bash", "-c", "--", "exit 2", "--", "echo b"},
+			errMsg: "3 attempts failed: attempt[0]: exit status 2; attempt[1]: exit status 2; attempt[2]: exit status 2: run left",
+		},
+		{
+			title: "diff exec with label",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff -u", "bash", "--", true)
+				c.DiffExec = true
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "b c"},
+			want: `--- echo a
++++ echo 'b c'
+@@ -1 +1 @@
+-a
++b c
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "label format",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff -u", "bash", "--", false)
+				c.LabelFormat = "{{.Side}}: {{.Args | shellquote}}"
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "b c"},
+			want: `--- left: echo a
++++ right: echo 'b c'
+@@ -1 +1 @@
+-a
++b c
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "left and right labels",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff -u", "bash", "--", false)
+				c.LabelFormat = "{{.Name}}"
+				c.LeftLabel = "old {{.Vars.v}}"
+				c.Vars = []string{"v=1,2"}
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "b"},
+			want: `--- old 1
++++ right
+@@ -1 +1 @@
+-a
++b
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "diff exec with label format",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, "diff -u", "", "--", false)
+				c.DiffExec = true
+				c.LabelFormat = `{{.Index}} {{join "," .Args}}`
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "b"},
+			want: `--- 0 echo,a
++++ 1 echo,b
+@@ -1 +1 @@
+-a
++b
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "diff exec with quotes",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, `diff -u --label "left side" --label 'right side'`, "", "--", false)
+				c.DiffExec = true
+				return c
+			}(),
+			args: []string{"echo", "--", "a", "--", "b"},
+			want: `--- left side
++++ right side
+@@ -1 +1 @@
+-a
++b
+`,
+			errMsg: "exit status 1",
+		},
+		{
+			title: "diff exec with invalid diff",
+			c: func() *config.Config {
+				c := config.NewConfig(nil, nil, nil, `diff 'a`, "bash", "--", false)
+				c.DiffExec = true
+				return c
+			}(),
+			args:    []string{"echo", "--", "a", "--", "b"},
+			initErr: true,
+			errMsg:  "unterminated single quote",
+		},
 		{
 			title: "interceptor1 fail",
 			c: config.NewConfig(nil, []string{
@@ -212,3 +1381,112 @@ func TestMain(t *testing.T) {
 		})
 	}
 }
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		title      string
+		diff       string
+		preprocess []string
+		stream     bool
+		bench      int
+		hooks      []string
+		timeout    time.Duration
+		failOn     string
+		args       []string
+		want       int
+	}{
+		{
+			title: "same",
+			args:  []string{"echo", "--", "a", "--", "a"},
+			want:  run.ExitSame,
+		},
+		{
+			title: "diff found",
+			args:  []string{"echo", "--", "a", "--", "b"},
+			want:  run.ExitDiffFound,
+		},
+		{
+			title:  "diff found fail on error",
+			failOn: config.FailOnError,
+			args:   []string{"echo", "--", "a", "--", "b"},
+			want:   run.ExitSame,
+		},
+		{
+			title: "generate failed",
+			args:  []string{"bash", "-c", "--", "exit 1", "--", "echo b"},
+			want:  run.ExitGenerate,
+		},
+		{
+			title:  "generate failed fail on error",
+			failOn: config.FailOnError,
+			args:   []string{"bash", "-c", "--", "exit 1", "--", "echo b"},
+			want:   run.ExitGenerate,
+		},
+		{
+			title:  "generate failed fail never",
+			failOn: config.FailOnNever,
+			args:   []string{"bash", "-c", "--", "exit 1", "--", "echo b"},
+			want:   run.ExitSame,
+		},
+		{
+			title: "bench generate failed",
+			bench: 1,
+			args:  []string{"bash", "-c", "--", "exit 1", "--", "echo b"},
+			want:  run.ExitGenerate,
+		},
+		{
+			title:      "stream source failed",
+			preprocess: []string{"cat"},
+			stream:     true,
+			args:       []string{"bash", "-c", "--", "exit 1", "--", "echo b"},
+			want:       run.ExitGenerate,
+		},
+		{
+			title:      "preprocess failed",
+			preprocess: []string{"exit 1"},
+			args:       []string{"echo", "--", "a", "--", "b"},
+			want:       run.ExitPreprocess,
+		},
+		{
+			title:      "stream preprocess failed",
+			preprocess: []string{"exit 1"},
+			stream:     true,
+			args:       []string{"echo", "--", "a", "--", "b"},
+			want:       run.ExitPreprocess,
+		},
+		{
+			title:   "timeout",
+			timeout: 100 * time.Millisecond,
+			args:    []string{"sleep", "--", "0", "--", "10"},
+			want:    run.ExitTimeout,
+		},
+		{
+			title: "diff failed",
+			diff:  "diff --no-such-flag",
+			args:  []string{"echo", "--", "a", "--", "b"},
+			want:  run.ExitDiffFailed,
+		},
+		{
+			title: "teardown failed after diff found",
+			hooks: []string{"teardown=exit 1"},
+			args:  []string{"echo", "--", "a", "--", "b"},
+			want:  run.ExitError,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			diff := tc.diff
+			if diff == "" {
+				diff = "diff"
+			}
+			c := config.NewConfig(&bytes.Buffer{}, nil, tc.preprocess, diff, "bash", "--", false)
+			c.Stream = tc.stream
+			c.Bench = tc.bench
+			c.Hooks = tc.hooks
+			c.Timeout = tc.timeout
+			c.FailOn = tc.failOn
+			c.WorkDir = t.TempDir()
+			assert.Nil(t, c.Init(tc.args))
+			assert.Equal(t, tc.want, run.ExitCode(run.Main(c), c.FailOn))
+		})
+	}
+}
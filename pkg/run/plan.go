@@ -0,0 +1,287 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/graph"
+	"github.com/berquerant/cmdcomp/pkg/shell"
+)
+
+// Placeholders of the outputs in the diff command of the plan.
+const (
+	planLeftFile  = "LEFT_FILE"
+	planRightFile = "RIGHT_FILE"
+)
+
+// plan is the resolved commands to be executed.
+type plan struct {
+	// Mode is one of compare, sweep, bench and graph.
+	Mode string `json:"mode"`
+	// Concurrent is true if the sides run concurrently.
+	Concurrent bool `json:"concurrent"`
+	// Stream is true if the commands are piped into the preprocess directly.
+	Stream       bool        `json:"stream,omitempty"`
+	Bench        int         `json:"bench,omitempty"`
+	Sides        []*planSide `json:"sides"`
+	Interceptors [][]string  `json:"interceptors,omitempty"`
+	// LeftIsolated are the indexes of the interceptors running concurrently with left.
+	LeftIsolated []int `json:"left_isolated,omitempty"`
+	// Undo are the undo commands of the interceptors at the same positions.
+	Undo  [][]string  `json:"undo,omitempty"`
+	Hooks []*planHook `json:"hooks,omitempty"`
+	// Stages are the stages of the graph in a topological order.
+	Stages []*planStage `json:"stages,omitempty"`
+	Pairs  []*planPair  `json:"pairs,omitempty"`
+	// Watch are the paths to be watched.
+	Watch []string `json:"watch,omitempty"`
+	// Brief is set if the outputs are compared by the hashes instead of Diff.
+	Brief string `json:"brief,omitempty"`
+	// Labels are the custom labels of the diff, left and right.
+	Labels []string `json:"labels,omitempty"`
+	Diff   []string `json:"diff"`
+}
+
+type planSide struct {
+	Name       string     `json:"name"`
+	Args       []string   `json:"args"`
+	Preprocess [][]string `json:"preprocess,omitempty"`
+}
+
+// pipeline returns the side as a shell pipeline.
+func (s planSide) pipeline() string {
+	xs := []string{shell.Join(s.Args)}
+	for _, p := range s.Preprocess {
+		xs = append(xs, shell.Join(p))
+	}
+	return strings.Join(xs, " | ")
+}
+
+type planHook struct {
+	Phase string   `json:"phase"`
+	Args  []string `json:"args"`
+}
+
+type planStage struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Args are the commands of the stage; the inputs of a differ are the names of the input stages.
+	Args   [][]string `json:"args,omitempty"`
+	Inputs []string   `json:"inputs,omitempty"`
+	After  []string   `json:"after,omitempty"`
+}
+
+// String returns the stage as a line.
+func (s planStage) String() string {
+	xs := make([]string, len(s.Args))
+	for i, x := range s.Args {
+		xs[i] = shell.Join(x)
+	}
+	line := fmt.Sprintf("%s (%s): %s", s.Name, s.Kind, strings.Join(xs, " | "))
+	if len(s.Inputs) > 0 {
+		line += fmt.Sprintf(" <- %s", strings.Join(s.Inputs, ", "))
+	}
+	if len(s.After) > 0 {
+		line += fmt.Sprintf(" after %s", strings.Join(s.After, ", "))
+	}
+	return line
+}
+
+func (r *runner) newPlanStages(spec *config.Graph) []*planStage {
+	var (
+		sides  = r.graphSides(spec)
+		stages = make(map[string]*config.GraphStage, len(spec.Stages))
+		g      = graph.New()
+	)
+	for _, s := range spec.Stages {
+		stages[s.Name] = s
+		_ = g.Add(&graph.Stage{
+			Name:   s.Name,
+			Inputs: s.Inputs,
+			After:  s.After,
+		})
+	}
+	// config.Init ensures that the graph is a DAG
+	order, _ := g.Order()
+
+	xs := make([]*planStage, len(order))
+	for i, name := range order {
+		s := stages[name]
+		x := &planStage{
+			Name:   s.Name,
+			Kind:   s.Kind,
+			Inputs: s.Inputs,
+			After:  s.After,
+		}
+		switch s.Kind {
+		case config.StageSource:
+			x.Args = [][]string{sides[s.Name].Args}
+		case config.StageDiffer:
+			left, right := s.Inputs[0], s.Inputs[1]
+			if r.Brief == "" {
+				diff, _ := r.newDiffCmdArgs(sides[left], sides[right], left, right)
+				x.Args = [][]string{diff}
+			}
+		default:
+			for _, c := range s.Commands {
+				x.Args = append(x.Args, []string{r.Shell, "-c", c})
+			}
+		}
+		xs[i] = x
+	}
+	return xs
+}
+
+type planPair struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+}
+
+func (r *runner) newPlanSide(side config.Side) *planSide {
+	s := &planSide{
+		Name: side.Name,
+		Args: side.Args,
+	}
+	for _, p := range side.Preprocess {
+		s.Preprocess = append(s.Preprocess, []string{r.Shell, "-c", p})
+	}
+	return s
+}
+
+func (r *runner) newPlan() *plan {
+	p := &plan{
+		Stream: r.Stream && len(r.Preprocess) > 0,
+	}
+	for _, x := range r.Interceptor {
+		p.Interceptors = append(p.Interceptors, []string{r.Shell, "-c", x})
+	}
+	p.LeftIsolated, _ = r.GetInterceptorIndexes()
+	for _, x := range r.InterceptorUndo {
+		var undo []string
+		if x != "" {
+			undo = []string{r.Shell, "-c", x}
+		}
+		p.Undo = append(p.Undo, undo)
+	}
+	for _, phase := range config.HookPhases {
+		for _, x := range r.GetHooks(phase) {
+			p.Hooks = append(p.Hooks, &planHook{
+				Phase: phase,
+				Args:  []string{r.Shell, "-c", x},
+			})
+		}
+	}
+
+	var left, right config.Side
+	switch {
+	case r.GetGraph() != nil:
+		p.Mode = "graph"
+		p.Concurrent = true
+		p.Stages = r.newPlanStages(r.GetGraph())
+		p.Brief = r.Brief
+		return p
+	case r.Sweep != "":
+		p.Mode = "sweep"
+		p.Concurrent = true
+		sides := r.GetSweep()
+		for _, s := range sides {
+			p.Sides = append(p.Sides, r.newPlanSide(s))
+		}
+		for _, x := range r.GetSweepPairs() {
+			p.Pairs = append(p.Pairs, &planPair{
+				Left:  sides[x.Left].Name,
+				Right: sides[x.Right].Name,
+			})
+		}
+		// the labels of the first pair
+		left, right = sides[0], sides[1]
+	case r.Bench > 0:
+		p.Mode = "bench"
+		p.Bench = r.Bench
+		left, right = r.GetLeft(), r.GetRight()
+		p.Sides = []*planSide{r.newPlanSide(left), r.newPlanSide(right)}
+	default:
+		p.Mode = "compare"
+		p.Concurrent = len(r.Interceptor) == 0
+		left, right = r.GetLeft(), r.GetRight()
+		p.Sides = []*planSide{r.newPlanSide(left), r.newPlanSide(right)}
+	}
+
+	p.Brief = r.Brief
+	p.Watch = r.Watch
+	if !r.BenchOnly && r.Brief == "" {
+		// config.Init ensures that the diff can be split and the labels can be rendered
+		p.Diff, _ = r.newDiffCmdArgs(left, right, planLeftFile, planRightFile)
+		if leftLabel, rightLabel, ok, _ := r.GetLabels(left, right); ok {
+			p.Labels = []string{leftLabel, rightLabel}
+		}
+	}
+	return p
+}
+
+func (p plan) execution() string {
+	switch {
+	case p.Mode == "graph":
+		return "each stage starts as soon as its inputs are ready"
+	case p.Mode == "sweep":
+		return "the values run concurrently, then the pairs are compared"
+	case p.Mode == "bench" && len(p.Interceptors) > 0:
+		return fmt.Sprintf("left runs %d times, then the interceptors, then right runs %d times", p.Bench, p.Bench)
+	case p.Mode == "bench":
+		return fmt.Sprintf("left and right run alternately %d times", p.Bench)
+	case p.Concurrent:
+		return "left and right run concurrently"
+	case len(p.LeftIsolated) > 0:
+		return "left and the left-isolated interceptors run concurrently, then the other interceptors and right run sequentially; left preprocess starts as soon as left finishes"
+	default:
+		return "left, the interceptors and right run sequentially; left preprocess starts as soon as left finishes"
+	}
+}
+
+func (r *runner) writePlan() error {
+	p := r.newPlan()
+	if r.DryRun == config.DryRunJSON {
+		return json.NewEncoder(r.Writer).Encode(p)
+	}
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "mode: %s\n", p.Mode)
+	_, _ = fmt.Fprintf(&b, "execution: %s\n", p.execution())
+	if p.Stream {
+		_, _ = fmt.Fprintln(&b, "stream: the commands are piped into the preprocess directly")
+	}
+	for _, s := range p.Sides {
+		_, _ = fmt.Fprintf(&b, "%s: %s\n", s.Name, s.pipeline())
+	}
+	for i, x := range p.Interceptors {
+		_, _ = fmt.Fprintf(&b, "interceptor[%d]: %s\n", i, shell.Join(x))
+		if i < len(p.Undo) && len(p.Undo[i]) > 0 {
+			_, _ = fmt.Fprintf(&b, "interceptor[%d] undo: %s\n", i, shell.Join(p.Undo[i]))
+		}
+	}
+	for _, x := range p.Hooks {
+		_, _ = fmt.Fprintf(&b, "%s hook: %s\n", x.Phase, shell.Join(x.Args))
+	}
+	for _, x := range p.Stages {
+		_, _ = fmt.Fprintf(&b, "stage %s\n", x)
+	}
+	for _, x := range p.Pairs {
+		_, _ = fmt.Fprintf(&b, "pair: %s -> %s\n", x.Left, x.Right)
+	}
+	if len(p.Watch) > 0 {
+		_, _ = fmt.Fprintf(&b, "watch: %s\n", shell.Join(p.Watch))
+	}
+	if p.Brief != "" {
+		_, _ = fmt.Fprintf(&b, "brief: compare the sha256 of the outputs (%s)\n", p.Brief)
+	}
+	if len(p.Labels) > 0 {
+		_, _ = fmt.Fprintf(&b, "labels: %s\n", shell.Join(p.Labels))
+	}
+	if len(p.Diff) > 0 {
+		_, _ = fmt.Fprintf(&b, "diff: %s\n", shell.Join(p.Diff))
+	}
+	_, err := fmt.Fprint(r.Writer, b.String())
+	return err
+}
@@ -0,0 +1,66 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// An error from all the attempts.
+// The errors of the attempts can be inspected by errors.Is and errors.As.
+type attemptsError struct {
+	errs []error
+}
+
+func (e *attemptsError) Error() string {
+	xs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		xs[i] = fmt.Sprintf("attempt[%d]: %v", i, err)
+	}
+	if len(e.errs) == 1 {
+		return fmt.Sprintf("1 attempt failed: %s", xs[0])
+	}
+	return fmt.Sprintf("%d attempts failed: %s", len(e.errs), strings.Join(xs, "; "))
+}
+
+func (e *attemptsError) Unwrap() []error {
+	return e.errs
+}
+
+// retry calls f until it succeeds or it fails retries+1 times.
+// The wait before each retry starts from --retryBackoff and doubles.
+func (r *runner) retry(ctx context.Context, stage string, retries int, f func(attempt int) error) error {
+	var (
+		errs    []error
+		backoff = r.RetryBackoff
+	)
+	for attempt := 0; ; attempt++ {
+		err := f(attempt)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if attempt >= retries || ctx.Err() != nil {
+			break
+		}
+		slog.Warn("retry",
+			slog.String("stage", stage),
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			slog.Any("err", err),
+		)
+		select {
+		case <-ctx.Done():
+			// the cancellation is not an attempt
+			return fmt.Errorf("%w: canceled during backoff after %w", context.Cause(ctx), &attemptsError{errs: errs})
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return &attemptsError{errs: errs}
+}
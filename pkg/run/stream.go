@@ -0,0 +1,52 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/execx"
+)
+
+// stream returns true if the command of the side is piped into its preprocess directly.
+func (r *runner) stream(side config.Side) bool {
+	return r.Stream && len(side.Preprocess) > 0
+}
+
+// runStream runs the command of the side piped into the preprocess pipeline,
+// and returns the filepath of the output of the pipeline.
+//
+// The output of the command is kept in the working directory only if --workDir is given.
+func (r *runner) runStream(ctx context.Context, side config.Side, attempt int) (string, error) {
+	var tee string
+	if r.WorkDir != "" {
+		d, err := os.MkdirTemp(r.TempDir, "cmdcomp")
+		if err != nil {
+			return "", err
+		}
+		tee = filepath.Join(d, "out")
+	}
+
+	var (
+		cmd  = r.newCmd(side.Args...)
+		pipe = r.newPreprocessCmds(side.Preprocess)
+		s    = execx.NewStream(ctx, r.TempDir, tee, cmd, pipe...)
+		logs = make([]*cmdLog, 0, len(pipe)+1)
+	)
+	logs = append(logs, newCmdLog(stageGenerate, side.Name, attempt, side.Args))
+	for _, x := range pipe {
+		v, _ := x.IntoExecCmd(ctx)
+		logs = append(logs, newCmdLog(stagePreprocess, side.Name, attempt, v.Args))
+	}
+	s.SetLimit(r.outputLimit())
+	err := timeoutError(ctx, s.Run(ctx))
+	logs[0].close(tee, err)
+	for _, x := range logs[1:] {
+		x.close(s.Path(), err)
+	}
+	for _, x := range logs {
+		r.logC <- x
+	}
+	return s.Path(), err
+}
@@ -0,0 +1,103 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"golang.org/x/sync/errgroup"
+)
+
+// runSide runs the command and the preprocess of the side.
+func (r *runner) runSide(ctx context.Context, side config.Side) (string, error) {
+	out, err := r.runGenCmd(ctx, side)
+	if err != nil {
+		return "", err
+	}
+	return r.runSidePreprocess(ctx, side, out)
+}
+
+// runSweep renders each sweep value once and compares the pairs of them.
+func (r *runner) runSweep(ctx context.Context) error {
+	var (
+		sides     = r.GetSweep()
+		outs      = make([]string, len(sides))
+		eg, egCtx = errgroup.WithContext(ctx)
+	)
+	eg.SetLimit(runtime.GOMAXPROCS(0))
+	for i, side := range sides {
+		eg.Go(func() error {
+			out, err := r.runSide(egCtx, side)
+			if err != nil {
+				return err
+			}
+			outs[i] = out
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	var (
+		pairs   = r.GetSweepPairs()
+		results = make([]error, len(pairs))
+	)
+	for i, p := range pairs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		left, right := sides[p.Left], sides[p.Right]
+		if r.Brief == "" || r.Brief == config.BriefText {
+			_, _ = fmt.Fprintf(r.Writer, "# %s: %s -> %s\n", r.Sweep, left.Name, right.Name)
+		}
+		results[i] = r.runDiff(ctx, left, right, outs[p.Left], outs[p.Right])
+	}
+
+	if r.Brief == "" || r.Brief == config.BriefText {
+		// keep the output JSON lines or empty
+		r.writeSweepSummary(sides, pairs, results)
+	}
+	return sweepError(results)
+}
+
+func (r *runner) writeSweepSummary(sides []config.Side, pairs []config.SweepPair, results []error) {
+	w := tabwriter.NewWriter(r.Writer, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "# Summary")
+	_, _ = fmt.Fprintln(w, "LEFT\tRIGHT\tRESULT")
+	for i, p := range pairs {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", sides[p.Left].Name, sides[p.Right].Name, sweepResultString(results[i]))
+	}
+	_ = w.Flush()
+}
+
+func sweepResultString(err error) string {
+	switch {
+	case err == nil:
+		return "same"
+	case IsDiffFound(err):
+		return "differ"
+	default:
+		return "error"
+	}
+}
+
+// sweepError returns the first error other than diffs found,
+// or the first diffs found.
+func sweepError(results []error) error {
+	var found error
+	for _, err := range results {
+		if err == nil {
+			continue
+		}
+		if !IsDiffFound(err) {
+			return err
+		}
+		if found == nil {
+			found = err
+		}
+	}
+	return found
+}
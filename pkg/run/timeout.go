@@ -0,0 +1,38 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// An error from timeout.
+var ErrTimeout = errors.New("Timeout")
+
+// withDeadline returns a context canceled after --deadline.
+func withDeadline(ctx context.Context, deadline time.Duration) (context.Context, context.CancelFunc) {
+	if deadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, deadline, fmt.Errorf("%w: deadline %s exceeded", ErrTimeout, deadline))
+}
+
+// withTimeout returns a context canceled after --timeout.
+func (r *runner) withTimeout(ctx context.Context, stage string) (context.Context, context.CancelFunc) {
+	if r.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, r.Timeout, fmt.Errorf("%w: %s exceeded %s", ErrTimeout, stage, r.Timeout))
+}
+
+// timeoutError adds the cause to err if ctx is done by timeout.
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTimeout) {
+		return fmt.Errorf("%w: %w", cause, err)
+	}
+	return err
+}
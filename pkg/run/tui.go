@@ -0,0 +1,51 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/tui"
+)
+
+// runTUI browses the diff of the outputs on the terminal.
+func (r *runner) runTUI(ctx context.Context, out *os.File, leftSide, rightSide config.Side, left, right string) error {
+	leftLabel, rightLabel, err := r.sideLabels(leftSide, rightSide)
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	leftLines, err := readLines(left)
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	rightLines, err := readLines(right)
+	if err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+
+	var (
+		lines                   = tui.Diff(leftLines, rightLines)
+		leftTitles, rightTitles []string
+	)
+	if tui.IsYAML(leftLines) || tui.IsYAML(rightLines) {
+		leftTitles, rightTitles = tui.DocTitles(leftLines), tui.DocTitles(rightLines)
+	}
+	m := tui.NewModel(lines, leftTitles, rightTitles, 80, 24)
+	m.SetLabels(leftLabel, rightLabel)
+	if err := tui.Run(ctx, out, m); err != nil {
+		return errors.Join(ErrDiff, err)
+	}
+	if tui.Changed(lines) {
+		return errors.Join(ErrDiff, ErrDiffFound)
+	}
+	return nil
+}
+
+func readLines(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return tui.SplitLines(string(b)), nil
+}
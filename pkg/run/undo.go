@@ -0,0 +1,56 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// undoAction is the undo command of the succeeded interceptor.
+type undoAction struct {
+	stage   string
+	command string
+}
+
+// pushUndo pushes the undo command of the interceptor, if any.
+func (r *runner) pushUndo(index int) {
+	if index >= len(r.InterceptorUndo) || r.InterceptorUndo[index] == "" {
+		return
+	}
+	r.undo = append(r.undo, &undoAction{
+		stage:   fmt.Sprintf("interceptor[%d] undo", index),
+		command: r.InterceptorUndo[index],
+	})
+}
+
+// runUndo pops and runs all the undo commands in reverse order,
+// even if some of them fail or ctx is done.
+func (r *runner) runUndo(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	var errs []error
+	for len(r.undo) > 0 {
+		x := r.undo[len(r.undo)-1]
+		r.undo = r.undo[:len(r.undo)-1]
+		slog.Debug("undo", slog.String("stage", x.stage), slog.String("command", x.command))
+		if err := r.runUndoAction(ctx, x); err != nil {
+			errs = append(errs, fmt.Errorf("%w: run %s", err, x.stage))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *runner) runUndoAction(ctx context.Context, x *undoAction) error {
+	ctx, cancel := r.withTimeout(ctx, x.stage)
+	defer cancel()
+	cmd := r.newShellExecCmd(ctx, x.command)
+	cmd.Stdout = os.Stderr // undo stdout cannot be mixed with diff stdout
+	cmd.Stderr = os.Stderr
+	log := newCmdLog(stageInterceptor, "", 0, cmd.Args)
+	log.phase = "undo"
+	err := timeoutError(ctx, cmd.Run())
+	log.close("", err)
+	r.logC <- log
+	return err
+}
@@ -0,0 +1,154 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/berquerant/cmdcomp/pkg/config"
+	"github.com/berquerant/cmdcomp/pkg/shell"
+	"github.com/berquerant/cmdcomp/pkg/watch"
+)
+
+// runWatch runs the comparison, and reruns it on every change of the watched files until ctx is done.
+//
+// Only the side whose args or preprocess refer to the changed files reruns,
+// unless there are interceptors.
+func (r *runner) runWatch(ctx context.Context) error {
+	w, err := watch.New(r.Watch, r.WatchInclude, r.WatchExclude)
+	if err != nil {
+		return err
+	}
+
+	var result *cmdResult
+	compare := func(left, right bool) {
+		clearScreen(r.Writer)
+		var err error
+		result, err = r.runWatchOnce(ctx, result, left, right)
+		switch {
+		case err == nil:
+			slog.Info("watch: same")
+		case IsDiffFound(err):
+			slog.Info("watch: differ")
+		default:
+			slog.Error("watch", slog.Any("err", err))
+		}
+	}
+
+	compare(true, true)
+	err = w.Watch(ctx, r.WatchInterval, r.WatchDebounce, func(changed []string) {
+		left, right := r.attribute(changed)
+		slog.Info("watch: rerun", slog.Any("changed", changed), slog.Bool("left", left), slog.Bool("right", right))
+		compare(left, right)
+	})
+	if errors.Is(err, context.Canceled) {
+		// interrupted
+		return nil
+	}
+	return timeoutError(ctx, err)
+}
+
+// runWatchOnce runs the sides to be rerun and the diff.
+// Returns the outputs of the sides to be reused, or nil if the sides failed.
+func (r *runner) runWatchOnce(ctx context.Context, prev *cmdResult, left, right bool) (*cmdResult, error) {
+	var (
+		result *cmdResult
+		err    error
+	)
+	switch {
+	case prev == nil || len(r.Interceptor) > 0 || (left && right):
+		result, err = r.runSides(ctx)
+	case left:
+		x := *prev
+		result = &x
+		result.leftOut, err = r.runLeftSide(ctx)
+	default:
+		x := *prev
+		result = &x
+		result.rightOut, err = r.runRightSide(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, r.runDiff(ctx, r.GetLeft(), r.GetRight(), result.leftOut, result.rightOut)
+}
+
+// attribute returns the sides referring to the changed files.
+// Returns both if any file cannot be attributed.
+func (r *runner) attribute(changed []string) (bool, bool) {
+	var (
+		leftPaths   = sidePaths(r.GetLeft())
+		rightPaths  = sidePaths(r.GetRight())
+		left, right bool
+	)
+	for _, p := range changed {
+		inLeft, inRight := matchPaths(p, leftPaths), matchPaths(p, rightPaths)
+		if !inLeft && !inRight {
+			return true, true
+		}
+		left = left || inLeft
+		right = right || inRight
+	}
+	return left, right
+}
+
+// sidePaths returns the absolute paths that may be referred by the args and the preprocess of the side.
+func sidePaths(side config.Side) []string {
+	words := side.Args
+	for _, p := range side.Preprocess {
+		xs, err := shell.Split(p)
+		if err != nil {
+			xs = strings.Fields(p)
+		}
+		words = append(words, xs...)
+	}
+
+	var paths []string
+	for _, w := range words {
+		candidates := []string{w}
+		if _, v, ok := strings.Cut(w, "="); ok {
+			// like --values=file
+			candidates = append(candidates, v)
+		}
+		for _, c := range candidates {
+			if c == "" || strings.HasPrefix(c, "-") {
+				continue
+			}
+			if x, err := filepath.Abs(c); err == nil {
+				paths = append(paths, x)
+			}
+		}
+	}
+	return paths
+}
+
+func matchPaths(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerminal returns true if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// clearScreen clears the terminal; does nothing if w is not a terminal.
+func clearScreen(w io.Writer) {
+	if isTerminal(w) {
+		_, _ = fmt.Fprint(w, "\033[H\033[2J")
+	}
+}
@@ -0,0 +1,109 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Quote returns s quoted for POSIX shells if necessary.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !needsQuote(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func needsQuote(s string) bool {
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("-_./=:,+@%", r):
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Join quotes each arg and joins them with spaces.
+func Join(args []string) string {
+	xs := make([]string, len(args))
+	for i, x := range args {
+		xs[i] = Quote(x)
+	}
+	return strings.Join(xs, " ")
+}
+
+var ErrSplit = errors.New("Split")
+
+// Split splits s into words like POSIX shells.
+//
+// Supports the single quotes, the double quotes and the backslash escapes.
+// Does not expand variables, globs and so on.
+func Split(s string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		rs     = []rune(s)
+	)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			inWord = true
+			i++
+			if i >= len(rs) {
+				return nil, fmt.Errorf("%w: trailing backslash: %s", ErrSplit, s)
+			}
+			if rs[i] != '\n' { // line continuation
+				word.WriteRune(rs[i])
+			}
+		case r == '\'':
+			inWord = true
+			j := i + 1
+			for j < len(rs) && rs[j] != '\'' {
+				j++
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("%w: unterminated single quote: %s", ErrSplit, s)
+			}
+			word.WriteString(string(rs[i+1 : j]))
+			i = j
+		case r == '"':
+			inWord = true
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) && strings.ContainsRune("\"\\$`\n", rs[j+1]) {
+					j++
+					if rs[j] != '\n' {
+						word.WriteRune(rs[j])
+					}
+					continue
+				}
+				word.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("%w: unterminated double quote: %s", ErrSplit, s)
+			}
+			i = j
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
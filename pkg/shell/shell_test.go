@@ -0,0 +1,121 @@
+package shell_test
+
+import (
+	"testing"
+
+	"github.com/berquerant/cmdcomp/pkg/shell"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoin(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		args  []string
+		want  string
+	}{
+		{
+			title: "empty",
+			want:  "",
+		},
+		{
+			title: "plain",
+			args:  []string{"helm", "template", "--version=3.68.0", "./charts/a_b"},
+			want:  "helm template --version=3.68.0 ./charts/a_b",
+		},
+		{
+			title: "empty arg",
+			args:  []string{"echo", ""},
+			want:  "echo ''",
+		},
+		{
+			title: "space",
+			args:  []string{"echo", "a b"},
+			want:  "echo 'a b'",
+		},
+		{
+			title: "single quote",
+			args:  []string{"echo", "it's"},
+			want:  `echo 'it'\''s'`,
+		},
+		{
+			title: "meta",
+			args:  []string{"yq", `select(.kind=="Secret")`, "$HOME"},
+			want:  `yq 'select(.kind=="Secret")' '$HOME'`,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			assert.Equal(t, tc.want, shell.Join(tc.args))
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		s     string
+		want  []string
+		err   bool
+	}{
+		{
+			title: "empty",
+			s:     "",
+		},
+		{
+			title: "spaces",
+			s:     "  diff   -u\t--color ",
+			want:  []string{"diff", "-u", "--color"},
+		},
+		{
+			title: "single quote",
+			s:     `objdiff -c 'a b' '' x'y z'`,
+			want:  []string{"objdiff", "-c", "a b", "", "xy z"},
+		},
+		{
+			title: "double quote",
+			s:     `diff --label "a \"b\" \$c \x"`,
+			want:  []string{"diff", "--label", `a "b" $c \x`},
+		},
+		{
+			title: "backslash",
+			s:     `a\ b c\\d`,
+			want:  []string{"a b", `c\d`},
+		},
+		{
+			title: "single quote in double quote",
+			s:     `echo "it's"`,
+			want:  []string{"echo", "it's"},
+		},
+		{
+			title: "unterminated single quote",
+			s:     `echo 'a`,
+			err:   true,
+		},
+		{
+			title: "unterminated double quote",
+			s:     `echo "a`,
+			err:   true,
+		},
+		{
+			title: "trailing backslash",
+			s:     `echo \`,
+			err:   true,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			got, err := shell.Split(tc.s)
+			if tc.err {
+				assert.ErrorIs(t, err, shell.ErrSplit)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("roundtrip", func(t *testing.T) {
+		args := []string{"echo", "a b", "it's", "", `"$x"`, `\`}
+		got, err := shell.Split(shell.Join(args))
+		assert.Nil(t, err)
+		assert.Equal(t, args, got)
+	})
+}
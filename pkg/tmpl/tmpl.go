@@ -0,0 +1,85 @@
+package tmpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/berquerant/cmdcomp/pkg/shell"
+)
+
+var ErrTemplate = errors.New("Template")
+
+// Data is the value passed to the templates.
+type Data struct {
+	// Side is "left", "right", "sweep" or "diff".
+	Side string
+	// Index is 0 for left, 1 for right, the index of the value for sweep and -1 for diff.
+	Index   int
+	TempDir string
+	// Vars are the user-defined variables of the side.
+	Vars map[string]string
+}
+
+// LabelData is the value passed to the label templates.
+type LabelData struct {
+	// Side is "left" or "right", the position in the diff.
+	Side string
+	// Name is the name of the side, "left", "right" or the value of the sweep variable.
+	Name  string
+	Index int
+	// Args are the resolved args of the side.
+	Args []string
+	Vars map[string]string
+}
+
+var funcMap = template.FuncMap{
+	// shellquote quotes a string or joins quoted strings with spaces.
+	"shellquote": func(v any) (string, error) {
+		switch v := v.(type) {
+		case string:
+			return shell.Quote(v), nil
+		case []string:
+			return shell.Join(v), nil
+		default:
+			return "", fmt.Errorf("shellquote: unsupported type %T", v)
+		}
+	},
+	// join joins strings with sep.
+	"join": func(sep string, xs []string) string {
+		return strings.Join(xs, sep)
+	},
+}
+
+// Execute expands text as a text/template with data.
+//
+// Available functions:
+//
+//	shellquote: quote a string or join quoted strings with spaces
+//	join SEP: join strings with SEP
+func Execute(text string, data any) (string, error) {
+	t, err := template.New("").Option("missingkey=error").Funcs(funcMap).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: parse %q: %w", ErrTemplate, text, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%w: execute %q: %w", ErrTemplate, text, err)
+	}
+	return b.String(), nil
+}
+
+// ExecuteAll expands each text by Execute.
+func ExecuteAll(texts []string, data any) ([]string, error) {
+	xs := make([]string, len(texts))
+	for i, text := range texts {
+		x, err := Execute(text, data)
+		if err != nil {
+			return nil, err
+		}
+		xs[i] = x
+	}
+	return xs, nil
+}
@@ -0,0 +1,71 @@
+package tmpl_test
+
+import (
+	"testing"
+
+	"github.com/berquerant/cmdcomp/pkg/tmpl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecute(t *testing.T) {
+	data := tmpl.Data{
+		Side:    "left",
+		Index:   0,
+		TempDir: "/tmp/x",
+		Vars: map[string]string{
+			"v": "3.68.0",
+		},
+	}
+	for _, tc := range []struct {
+		title string
+		text  string
+		want  string
+		err   bool
+	}{
+		{
+			title: "plain",
+			text:  "echo",
+			want:  "echo",
+		},
+		{
+			title: "side",
+			text:  "{{.Side}}-{{.Index}}",
+			want:  "left-0",
+		},
+		{
+			title: "tempdir",
+			text:  "{{.TempDir}}/out",
+			want:  "/tmp/x/out",
+		},
+		{
+			title: "var",
+			text:  "--version={{.Vars.v}}",
+			want:  "--version=3.68.0",
+		},
+		{
+			title: "shellquote",
+			text:  `{{.Side | shellquote}} {{"a b" | shellquote}}`,
+			want:  `left 'a b'`,
+		},
+		{
+			title: "unknown var",
+			text:  "{{.Vars.x}}",
+			err:   true,
+		},
+		{
+			title: "invalid",
+			text:  "{{.Side",
+			err:   true,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			got, err := tmpl.Execute(tc.text, data)
+			if tc.err {
+				assert.ErrorIs(t, err, tmpl.ErrTemplate)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
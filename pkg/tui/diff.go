@@ -0,0 +1,233 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Op is the kind of a line of the diff.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is a line of the diff.
+type Line struct {
+	Op   Op
+	Text string
+	// Left and Right are the 1-based line numbers; 0 means the line does not exist on the side.
+	Left  int
+	Right int
+}
+
+// Diff returns the line diff from a to b by the Myers algorithm.
+//
+// The linear space variant is used, which divides the inputs at the middle snake recursively,
+// so that the memory is O(n+m) even for large inputs.
+func Diff(a, b []string) []Line {
+	lines := diff(nil, a, b)
+	var left, right int
+	for i, x := range lines {
+		if x.Op != Insert {
+			left++
+			lines[i].Left = left
+		}
+		if x.Op != Delete {
+			right++
+			lines[i].Right = right
+		}
+	}
+	return lines
+}
+
+// diff appends the diff from a to b to lines.
+func diff(lines []Line, a, b []string) []Line {
+	var prefix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for _, x := range a[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: x})
+	}
+	a, b = a[prefix:], b[prefix:]
+	var suffix int
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if x, y, ok := middleSnake(a, b); ok {
+		lines = diff(lines, a[:x], b[:y])
+		lines = diff(lines, a[x:], b[y:])
+	} else {
+		for _, x := range a {
+			lines = append(lines, Line{Op: Delete, Text: x})
+		}
+		for _, x := range b {
+			lines = append(lines, Line{Op: Insert, Text: x})
+		}
+	}
+	for _, x := range common {
+		lines = append(lines, Line{Op: Equal, Text: x})
+	}
+	return lines
+}
+
+// middleSnake returns the point where the shortest edit script from a to b is divided into two,
+// by searching it forward from the start and backward from the end at the same time.
+// Returns false if the script consists of deleting all of a and inserting all of b.
+func middleSnake(a, b []string) (int, int, bool) {
+	var (
+		n, m = len(a), len(b)
+		maxD = (n + m + 1) / 2
+		// the index of the diagonal k = x - y in v
+		offset = maxD
+		// vf[offset+k] is the furthest x of the forward paths on k,
+		// vb[offset+k] is the furthest x from the end of the backward paths on k
+		vf, vb = make([]int, 2*maxD+2), make([]int, 2*maxD+2)
+		delta  = n - m
+		// the forward paths meet the backward paths of the previous step if delta is odd
+		front = delta%2 != 0
+		// the diagonals out of the inputs are skipped
+		fStart, fEnd, bStart, bEnd int
+	)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	for d := range maxD {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case front:
+				if i := offset + delta - k; i >= 0 && i < len(vb) && vb[i] != -1 && x >= n-vb[i] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !front:
+				if i := offset + delta - k; i >= 0 && i < len(vf) && vf[i] != -1 && vf[i] >= n-x {
+					fx := vf[i]
+					return fx, fx - (i - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// SplitLines splits the content into lines without the trailing newline.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Hunk is a group of the changed lines and the context lines around them.
+type Hunk struct {
+	Lines []Line
+	// Title is the name of the YAML document containing the hunk, if any.
+	Title string
+}
+
+// Header returns the hunk header like diff -u.
+func (h Hunk) Header() string {
+	var (
+		leftStart, leftCount   int
+		rightStart, rightCount int
+	)
+	for _, x := range h.Lines {
+		if x.Left > 0 {
+			if leftCount == 0 {
+				leftStart = x.Left
+			}
+			leftCount++
+		}
+		if x.Right > 0 {
+			if rightCount == 0 {
+				rightStart = x.Right
+			}
+			rightCount++
+		}
+	}
+	s := fmt.Sprintf("@@ -%d,%d +%d,%d @@", leftStart, leftCount, rightStart, rightCount)
+	if h.Title != "" {
+		s += " " + h.Title
+	}
+	return s
+}
+
+// Changed returns true if the diff contains any changes.
+func Changed(lines []Line) bool {
+	return slices.ContainsFunc(lines, func(x Line) bool { return x.Op != Equal })
+}
+
+// Hunks groups the changed lines with context lines around them.
+func Hunks(lines []Line, context int) []Hunk {
+	var (
+		hunks      []Hunk
+		start, end = -1, -1
+	)
+	flush := func() {
+		if start >= 0 {
+			hunks = append(hunks, Hunk{Lines: lines[start:end]})
+		}
+	}
+	for i, x := range lines {
+		if x.Op == Equal {
+			continue
+		}
+		s, e := max(i-context, 0), min(i+context+1, len(lines))
+		if start >= 0 && s <= end {
+			end = max(end, e)
+			continue
+		}
+		flush()
+		start, end = s, e
+	}
+	flush()
+	return hunks
+}
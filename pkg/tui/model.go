@@ -0,0 +1,297 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of the context lines of the collapsed hunks.
+const contextLines = 3
+
+type mode int
+
+const (
+	modeView mode = iota
+	modeList
+	modeSearch
+)
+
+// Model is the state of the viewer, independent of the terminal.
+type Model struct {
+	lines       []Line
+	leftTitles  []string
+	rightTitles []string
+	// leftLabel and rightLabel are the names of the sides on the title line; empty means no title line.
+	leftLabel, rightLabel string
+
+	width, height int
+	sideBySide    bool
+	expanded      bool
+
+	hunks []Hunk
+	rows  []Row
+	top   int
+
+	mode    mode
+	cursor  int
+	query   string
+	input   string
+	message string
+}
+
+// NewModel returns the viewer of the diff.
+// The titles of the lines of each side are the titles of the hunks; nil means no titles.
+func NewModel(lines []Line, leftTitles, rightTitles []string, width, height int) *Model {
+	m := &Model{
+		lines:       lines,
+		leftTitles:  leftTitles,
+		rightTitles: rightTitles,
+	}
+	m.Resize(width, height)
+	return m
+}
+
+// SetLabels shows the labels of the sides on the title line at the top of the screen.
+func (m *Model) SetLabels(left, right string) {
+	m.leftLabel, m.rightLabel = left, right
+	m.scrollTo(m.top)
+}
+
+// Resize changes the size of the screen.
+func (m *Model) Resize(width, height int) {
+	m.width, m.height = max(width, 1), max(height, 2)
+	m.render()
+}
+
+func (m *Model) render() {
+	hunk := m.currentHunk()
+	context := contextLines
+	if m.expanded {
+		context = len(m.lines)
+	}
+	m.hunks = Hunks(m.lines, context)
+	TitleHunks(m.hunks, m.leftTitles, m.rightTitles)
+	if m.sideBySide {
+		m.rows = RenderSideBySide(m.hunks, m.width)
+	} else {
+		m.rows = RenderUnified(m.hunks)
+	}
+	m.top = 0
+	if !m.expanded {
+		m.jumpHunk(hunk)
+	}
+}
+
+func (m *Model) hasTitle() bool {
+	return m.leftLabel != "" || m.rightLabel != ""
+}
+
+func (m *Model) bodyHeight() int {
+	if m.hasTitle() {
+		return max(m.height-2, 1)
+	}
+	return m.height - 1
+}
+
+func (m *Model) title() string {
+	if m.sideBySide {
+		return fit("--- "+m.leftLabel, columnWidth(m.width)) + "   " + "+++ " + m.rightLabel
+	}
+	return "--- " + m.leftLabel + "  +++ " + m.rightLabel
+}
+
+// currentHunk returns the index of the hunk at the top of the screen.
+func (m *Model) currentHunk() int {
+	if m.top < len(m.rows) {
+		return m.rows[m.top].Hunk
+	}
+	return 0
+}
+
+func (m *Model) jumpHunk(hunk int) {
+	for i, x := range m.rows {
+		if x.Style == Header && x.Hunk == hunk {
+			m.scrollTo(i)
+			return
+		}
+	}
+}
+
+func (m *Model) scrollTo(top int) {
+	m.top = max(min(top, len(m.rows)-m.bodyHeight()), 0)
+}
+
+func (m *Model) nextHunk(forward bool) {
+	if forward {
+		for i := m.top + 1; i < len(m.rows); i++ {
+			if m.rows[i].Style == Header {
+				m.scrollTo(i)
+				return
+			}
+		}
+		return
+	}
+	for i := m.top - 1; i >= 0; i-- {
+		if m.rows[i].Style == Header {
+			m.scrollTo(i)
+			return
+		}
+	}
+}
+
+func (m *Model) search(forward bool) {
+	if m.query == "" {
+		return
+	}
+	n := len(m.rows)
+	for d := 1; d <= n; d++ {
+		i := (m.top + d) % n
+		if !forward {
+			i = ((m.top-d)%n + n) % n
+		}
+		if strings.Contains(m.rows[i].Text, m.query) {
+			m.scrollTo(i)
+			return
+		}
+	}
+	m.message = fmt.Sprintf("pattern not found: %s", m.query)
+}
+
+// Update changes the state by the key.
+// Returns true to quit.
+func (m *Model) Update(key string) bool {
+	m.message = ""
+	switch m.mode {
+	case modeSearch:
+		m.updateSearch(key)
+		return false
+	case modeList:
+		return m.updateList(key)
+	}
+
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "j", "down", "enter":
+		m.scrollTo(m.top + 1)
+	case "k", "up":
+		m.scrollTo(m.top - 1)
+	case "space", "f", "pgdown":
+		m.scrollTo(m.top + m.bodyHeight())
+	case "b", "pgup":
+		m.scrollTo(m.top - m.bodyHeight())
+	case "g", "home":
+		m.scrollTo(0)
+	case "G", "end":
+		m.scrollTo(len(m.rows))
+	case "]", "tab":
+		m.nextHunk(true)
+	case "[":
+		m.nextHunk(false)
+	case "s":
+		m.sideBySide = !m.sideBySide
+		m.render()
+	case "c":
+		m.expanded = !m.expanded
+		m.render()
+	case "l":
+		m.mode = modeList
+		m.cursor = m.currentHunk()
+	case "/":
+		m.mode = modeSearch
+		m.input = ""
+	case "n":
+		m.search(true)
+	case "N":
+		m.search(false)
+	}
+	return false
+}
+
+func (m *Model) updateSearch(key string) {
+	switch key {
+	case "enter":
+		m.mode = modeView
+		m.query = m.input
+		m.search(true)
+	case "esc", "ctrl-c":
+		m.mode = modeView
+	case "backspace":
+		if rs := []rune(m.input); len(rs) > 0 {
+			m.input = string(rs[:len(rs)-1])
+		}
+	case "space":
+		m.input += " "
+	default:
+		if len([]rune(key)) == 1 {
+			m.input += key
+		}
+	}
+}
+
+func (m *Model) updateList(key string) bool {
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "j", "down":
+		m.cursor = min(m.cursor+1, len(m.hunks)-1)
+	case "k", "up":
+		m.cursor = max(m.cursor-1, 0)
+	case "enter":
+		m.mode = modeView
+		m.jumpHunk(m.cursor)
+	case "l", "esc":
+		m.mode = modeView
+	}
+	return false
+}
+
+// View returns the rows on the screen: the title line if the labels are set, the body and the status line.
+func (m *Model) View() []Row {
+	var rows []Row
+	if m.hasTitle() {
+		rows = append(rows, Row{Text: m.title(), Style: Title})
+	}
+	if m.mode == modeList {
+		start := max(m.cursor-m.bodyHeight()+1, 0)
+		for i := start; i < len(m.hunks) && len(rows) < m.height-1; i++ {
+			r := Row{
+				Text: fmt.Sprintf("%4d %s", i+1, m.hunks[i].Header()),
+				Hunk: i,
+			}
+			if i == m.cursor {
+				r.Style = Selected
+			}
+			rows = append(rows, r)
+		}
+	} else {
+		end := min(m.top+m.bodyHeight(), len(m.rows))
+		rows = append(rows, m.rows[m.top:end]...)
+	}
+	for len(rows) < m.height-1 {
+		rows = append(rows, Row{Text: "~"})
+	}
+	return append(rows, Row{Text: m.status(), Style: Status})
+}
+
+func (m *Model) status() string {
+	switch {
+	case m.mode == modeSearch:
+		return "/" + m.input
+	case m.message != "":
+		return m.message
+	case len(m.hunks) == 0:
+		return "no differences; q:quit"
+	}
+	layout := "unified"
+	if m.sideBySide {
+		layout = "side-by-side"
+	}
+	context := "collapsed"
+	if m.expanded {
+		context = "expanded"
+	}
+	return fmt.Sprintf("[%d/%d] %s %s  q:quit ]/[:hunk l:list s:layout c:context /:search n/N:match",
+		m.currentHunk()+1, len(m.hunks), layout, context,
+	)
+}
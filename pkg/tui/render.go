@@ -0,0 +1,105 @@
+package tui
+
+import (
+	"strings"
+)
+
+// Style is the style of a row on the screen.
+type Style int
+
+const (
+	Plain Style = iota
+	Header
+	Deleted
+	Inserted
+	Modified
+	Selected
+	Status
+	Title
+)
+
+// Row is a line on the screen.
+type Row struct {
+	Text  string
+	Style Style
+	// Hunk is the index of the hunk containing the row.
+	Hunk int
+}
+
+// RenderUnified renders the hunks like diff -u.
+func RenderUnified(hunks []Hunk) []Row {
+	var rows []Row
+	for i, h := range hunks {
+		rows = append(rows, Row{Text: h.Header(), Style: Header, Hunk: i})
+		for _, x := range h.Lines {
+			switch x.Op {
+			case Delete:
+				rows = append(rows, Row{Text: "-" + x.Text, Style: Deleted, Hunk: i})
+			case Insert:
+				rows = append(rows, Row{Text: "+" + x.Text, Style: Inserted, Hunk: i})
+			default:
+				rows = append(rows, Row{Text: " " + x.Text, Hunk: i})
+			}
+		}
+	}
+	return rows
+}
+
+// RenderSideBySide renders the hunks in 2 columns, left and right, in width.
+func RenderSideBySide(hunks []Hunk, width int) []Row {
+	var (
+		colWidth = columnWidth(width)
+		rows     []Row
+	)
+	row := func(hunk int, left, sep, right string, style Style) Row {
+		return Row{
+			Text:  fit(left, colWidth) + sep + right,
+			Style: style,
+			Hunk:  hunk,
+		}
+	}
+	for i, h := range hunks {
+		rows = append(rows, Row{Text: h.Header(), Style: Header, Hunk: i})
+		var deleted, inserted []string
+		flush := func() {
+			for j := range max(len(deleted), len(inserted)) {
+				switch {
+				case j >= len(deleted):
+					rows = append(rows, row(i, "", " > ", inserted[j], Inserted))
+				case j >= len(inserted):
+					rows = append(rows, row(i, deleted[j], " < ", "", Deleted))
+				default:
+					rows = append(rows, row(i, deleted[j], " | ", inserted[j], Modified))
+				}
+			}
+			deleted, inserted = nil, nil
+		}
+		for _, x := range h.Lines {
+			switch x.Op {
+			case Delete:
+				deleted = append(deleted, x.Text)
+			case Insert:
+				inserted = append(inserted, x.Text)
+			default:
+				flush()
+				rows = append(rows, row(i, x.Text, "   ", x.Text, Plain))
+			}
+		}
+		flush()
+	}
+	return rows
+}
+
+// columnWidth returns the width of each column of the side-by-side layout.
+func columnWidth(width int) int {
+	return max((width-3)/2, 1)
+}
+
+// fit expands the tabs, and truncates or pads s to width runes.
+func fit(s string, width int) string {
+	rs := []rune(strings.ReplaceAll(s, "\t", "    "))
+	if len(rs) > width {
+		return string(rs[:width])
+	}
+	return string(rs) + strings.Repeat(" ", width-len(rs))
+}
@@ -0,0 +1,179 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Run runs the viewer on the terminal out until quit or ctx is done.
+// The keys are read from /dev/tty, which is put into raw mode by stty.
+func Run(ctx context.Context, out *os.File, m *Model) error {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	state, err := stty(tty, "-g")
+	if err != nil {
+		return err
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = stty(tty, strings.TrimSpace(state))
+	}()
+
+	// alternate screen, hide cursor
+	_, _ = io.WriteString(out, "\033[?1049h\033[?25l")
+	defer func() {
+		_, _ = io.WriteString(out, "\033[?25h\033[?1049l")
+	}()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	keys := make(chan string, 16)
+	go readKeys(tty, keys)
+
+	resize := func() {
+		// keep the current size if unknown
+		if h, w, err := terminalSize(tty); err == nil && h > 0 && w > 0 {
+			m.Resize(w, h)
+		}
+	}
+	resize()
+	for {
+		if err := draw(out, m); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-winch:
+			resize()
+		case key, ok := <-keys:
+			if !ok || m.Update(key) {
+				return nil
+			}
+		}
+	}
+}
+
+func stty(tty *os.File, arg ...string) (string, error) {
+	cmd := exec.Command("stty", arg...)
+	cmd.Stdin = tty
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: stty %s: %s", err, strings.Join(arg, " "), stderr.String())
+	}
+	return string(b), nil
+}
+
+// terminalSize returns the rows and the columns of the terminal.
+func terminalSize(tty *os.File) (int, int, error) {
+	s, err := stty(tty, "size")
+	if err != nil {
+		return 0, 0, err
+	}
+	var h, w int
+	if _, err := fmt.Sscan(s, &h, &w); err != nil {
+		return 0, 0, err
+	}
+	return h, w, nil
+}
+
+var styleColors = map[Style]string{
+	Header:   "\033[36m",
+	Deleted:  "\033[31m",
+	Inserted: "\033[32m",
+	Modified: "\033[33m",
+	Selected: "\033[7m",
+	Status:   "\033[7m",
+	Title:    "\033[1m",
+}
+
+func draw(out io.Writer, m *Model) error {
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, r := range m.View() {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		text := fit(r.Text, m.width)
+		if c, ok := styleColors[r.Style]; ok {
+			text = c + text + "\033[0m"
+		}
+		b.WriteString(text)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+var keyNames = map[string]string{
+	"\033[A":  "up",
+	"\033[B":  "down",
+	"\033[5~": "pgup",
+	"\033[6~": "pgdown",
+	"\033[H":  "home",
+	"\033[F":  "end",
+	"\033":    "esc",
+	"\r":      "enter",
+	"\n":      "enter",
+	"\t":      "tab",
+	" ":       "space",
+	"\x7f":    "backspace",
+	"\b":      "backspace",
+	"\x03":    "ctrl-c",
+}
+
+// readKeys sends the names of the pressed keys until tty is closed.
+func readKeys(tty io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := tty.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range splitKeys(string(buf[:n])) {
+			keys <- k
+		}
+	}
+}
+
+// splitKeys splits the input into the key names.
+func splitKeys(s string) []string {
+	var keys []string
+	for s != "" {
+		var k string
+		switch {
+		case strings.HasPrefix(s, "\033[") && len(s) >= 3:
+			end := strings.IndexFunc(s[2:], func(r rune) bool { return r >= 0x40 && r <= 0x7e })
+			if end < 0 {
+				k = s
+			} else {
+				k = s[:end+3]
+			}
+		default:
+			r := []rune(s)[0]
+			k = string(r)
+		}
+		s = s[len(k):]
+		if x, ok := keyNames[k]; ok {
+			k = x
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,244 @@
+package tui_test
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/berquerant/cmdcomp/pkg/tui"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		a, b  string
+		want  string
+	}{
+		{
+			title: "empty",
+		},
+		{
+			title: "same",
+			a:     "a\nb\n",
+			b:     "a\nb\n",
+			want:  " a\n b\n",
+		},
+		{
+			title: "insert",
+			a:     "a\n",
+			b:     "a\nb\n",
+			want:  " a\n+b\n",
+		},
+		{
+			title: "delete",
+			a:     "a\nb\n",
+			b:     "b\n",
+			want:  "-a\n b\n",
+		},
+		{
+			title: "change",
+			a:     "a\nb\nc\nd\n",
+			b:     "a\nx\nc\ny\nd\n",
+			want:  " a\n-b\n+x\n c\n+y\n d\n",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			var got strings.Builder
+			for _, x := range tui.Diff(tui.SplitLines(tc.a), tui.SplitLines(tc.b)) {
+				got.WriteString(string(" -+"[x.Op]) + x.Text + "\n")
+			}
+			assert.Equal(t, tc.want, got.String())
+		})
+	}
+}
+
+func TestDiffShortest(t *testing.T) {
+	// lcs returns the length of the longest common subsequence of a and b.
+	lcs := func(a, b []string) int {
+		dp := make([][]int, len(a)+1)
+		for i := range dp {
+			dp[i] = make([]int, len(b)+1)
+		}
+		for i := range a {
+			for j := range b {
+				if a[i] == b[j] {
+					dp[i+1][j+1] = dp[i][j] + 1
+				} else {
+					dp[i+1][j+1] = max(dp[i][j+1], dp[i+1][j])
+				}
+			}
+		}
+		return dp[len(a)][len(b)]
+	}
+	random := func(r *rand.Rand) []string {
+		var xs []string
+		for range r.IntN(30) {
+			xs = append(xs, strconv.Itoa(r.IntN(4)))
+		}
+		return xs
+	}
+
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 1000 {
+		a, b := random(r), random(r)
+		var gotA, gotB []string
+		var edits int
+		for _, x := range tui.Diff(a, b) {
+			if x.Op != tui.Insert {
+				gotA = append(gotA, x.Text)
+			}
+			if x.Op != tui.Delete {
+				gotB = append(gotB, x.Text)
+			}
+			if x.Op != tui.Equal {
+				edits++
+			}
+		}
+		assert.Equal(t, a, gotA)
+		assert.Equal(t, b, gotB)
+		assert.Equal(t, len(a)+len(b)-2*lcs(a, b), edits, "%v %v", a, b)
+	}
+
+	t.Run("large", func(t *testing.T) {
+		a, b := make([]string, 5000), make([]string, 5000)
+		for i := range a {
+			a[i], b[i] = "a"+strconv.Itoa(i), "b"+strconv.Itoa(i)
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		lines := tui.Diff(a, b)
+		runtime.ReadMemStats(&after)
+		assert.Len(t, lines, 10000)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(10<<20), "the memory should be linear")
+	})
+}
+
+func TestHunks(t *testing.T) {
+	var (
+		a = tui.SplitLines("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")
+		b = tui.SplitLines("1\nx\n3\n4\n5\n6\n7\n8\n9\ny\n")
+	)
+	lines := tui.Diff(a, b)
+	assert.True(t, tui.Changed(lines))
+	assert.False(t, tui.Changed(tui.Diff(a, a)))
+
+	hunks := tui.Hunks(lines, 1)
+	if !assert.Len(t, hunks, 2) {
+		return
+	}
+	assert.Equal(t, "@@ -1,3 +1,3 @@", hunks[0].Header())
+	assert.Equal(t, "@@ -9,2 +9,2 @@", hunks[1].Header())
+	assert.Len(t, tui.Hunks(lines, 4), 1, "merge overlapped hunks")
+}
+
+func TestDocTitles(t *testing.T) {
+	lines := tui.SplitLines(`---
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    name: x
+  name: svc
+spec:
+  name: y
+---
+a: b
+`)
+	assert.True(t, tui.IsYAML(lines))
+	assert.False(t, tui.IsYAML(tui.SplitLines("a\nb\n")))
+	titles := tui.DocTitles(lines)
+	assert.Equal(t, "Service/svc", titles[0])
+	assert.Equal(t, "Service/svc", titles[8])
+	assert.Equal(t, "document[1]", titles[9])
+
+	hunks := tui.Hunks(tui.Diff(lines, append(lines[:len(lines):len(lines)], "c: d")), 0)
+	tui.TitleHunks(hunks, titles, append(titles, titles[9]))
+	assert.Equal(t, "@@ -0,0 +12,1 @@ document[1]", hunks[0].Header())
+}
+
+func TestRenderSideBySide(t *testing.T) {
+	hunks := tui.Hunks(tui.Diff(tui.SplitLines("a\nb\nc\n"), tui.SplitLines("a\nx\ny\n")), 1)
+	var got []string
+	for _, r := range tui.RenderSideBySide(hunks, 11) {
+		got = append(got, r.Text)
+	}
+	assert.Equal(t, []string{
+		"@@ -1,3 +1,3 @@",
+		"a      a",
+		"b    | x",
+		"c    | y",
+	}, got)
+}
+
+func TestModel(t *testing.T) {
+	var a, b []string
+	for i := range 30 {
+		a = append(a, string(rune('a'+i%26)))
+		b = append(b, string(rune('a'+i%26)))
+	}
+	b[5] = "first"
+	b[25] = "second"
+	m := tui.NewModel(tui.Diff(a, b), nil, nil, 80, 5)
+
+	texts := func() []string {
+		var xs []string
+		for _, r := range m.View() {
+			xs = append(xs, r.Text)
+		}
+		return xs
+	}
+
+	assert.Len(t, m.View(), 5)
+	assert.Equal(t, "@@ -3,7 +3,7 @@", texts()[0])
+	assert.Contains(t, texts()[4], "[1/2] unified collapsed")
+
+	m.Update("]")
+	assert.Equal(t, "@@ -23,7 +23,7 @@", texts()[0])
+	m.Update("[")
+	assert.Equal(t, "@@ -3,7 +3,7 @@", texts()[0])
+
+	for _, k := range []string{"/", "s", "e", "c", "enter"} {
+		m.Update(k)
+	}
+	assert.Equal(t, "+second", texts()[0])
+	m.Update("/")
+	m.Update("z")
+	m.Update("z")
+	m.Update("enter")
+	assert.Equal(t, "pattern not found: zz", texts()[4])
+
+	m.Update("l")
+	m.Update("k")
+	m.Update("enter")
+	assert.Equal(t, "@@ -3,7 +3,7 @@", texts()[0])
+
+	m.Update("s")
+	assert.Contains(t, texts()[4], "side-by-side")
+	m.Update("c")
+	assert.Contains(t, texts()[4], "expanded")
+	assert.Equal(t, "@@ -1,30 +1,30 @@", texts()[0])
+	assert.True(t, m.Update("q"))
+}
+
+func TestModelLabels(t *testing.T) {
+	m := tui.NewModel(tui.Diff([]string{"a"}, []string{"b"}), nil, nil, 21, 5)
+	m.SetLabels("old", "new")
+	var got []string
+	for _, r := range m.View() {
+		got = append(got, r.Text)
+	}
+	assert.Equal(t, []string{
+		"--- old  +++ new",
+		"@@ -1,1 +1,1 @@",
+		"-a",
+		"+b",
+		got[4],
+	}, got)
+
+	m.Update("s")
+	assert.Equal(t, "--- old     +++ new", m.View()[0].Text)
+	assert.Equal(t, tui.Title, m.View()[0].Style)
+}
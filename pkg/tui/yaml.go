@@ -0,0 +1,95 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsYAML returns true if the lines look like YAML documents like the outputs of helm template.
+func IsYAML(lines []string) bool {
+	for _, x := range lines {
+		if isDocSeparator(x) || strings.HasPrefix(x, "apiVersion:") || strings.HasPrefix(x, "kind:") {
+			return true
+		}
+	}
+	return false
+}
+
+func isDocSeparator(line string) bool {
+	return line == "---" || strings.HasPrefix(line, "--- ")
+}
+
+// DocTitles returns the title of the YAML document containing each line,
+// like KIND/NAME or document[INDEX].
+func DocTitles(lines []string) []string {
+	var (
+		titles = make([]string, len(lines))
+		start  int
+		index  int
+	)
+	flush := func(end int) {
+		t := docTitle(lines[start:end], index)
+		for i := start; i < end; i++ {
+			titles[i] = t
+		}
+	}
+	for i, x := range lines {
+		if isDocSeparator(x) && i > start {
+			flush(i)
+			start = i
+			index++
+		}
+	}
+	flush(len(lines))
+	return titles
+}
+
+func docTitle(lines []string, index int) string {
+	var (
+		kind, name string
+		inMetadata bool
+	)
+	for _, x := range lines {
+		if x != "" && !strings.HasPrefix(x, " ") && !strings.HasPrefix(x, "#") {
+			// top-level key
+			inMetadata = x == "metadata:"
+			if strings.HasPrefix(x, "kind:") {
+				kind = yamlValue(x)
+			}
+			continue
+		}
+		if inMetadata && name == "" && strings.HasPrefix(x, "  name:") {
+			name = yamlValue(x)
+		}
+	}
+	switch {
+	case kind != "" && name != "":
+		return kind + "/" + name
+	case kind != "":
+		return kind
+	default:
+		return fmt.Sprintf("document[%d]", index)
+	}
+}
+
+func yamlValue(line string) string {
+	_, v, _ := strings.Cut(line, ":")
+	return strings.Trim(strings.TrimSpace(v), `"'`)
+}
+
+// TitleHunks sets the titles of the hunks by the titles of the lines of each side.
+func TitleHunks(hunks []Hunk, leftTitles, rightTitles []string) {
+	for i, h := range hunks {
+		for _, x := range h.Lines {
+			if x.Op == Equal {
+				continue
+			}
+			if x.Right > 0 && x.Right <= len(rightTitles) {
+				hunks[i].Title = rightTitles[x.Right-1]
+			} else if x.Left > 0 && x.Left <= len(leftTitles) {
+				hunks[i].Title = leftTitles[x.Left-1]
+			}
+			break
+		}
+	}
+}
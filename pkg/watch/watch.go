@@ -0,0 +1,175 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+var ErrWatch = errors.New("Watch")
+
+// Watcher polls the files to detect changes.
+type Watcher struct {
+	paths   []string
+	include []string
+	exclude []string
+}
+
+// New returns a watcher of the files and the directories.
+//
+// include and exclude are the glob patterns matched against the base names of the files.
+// Empty include means all files.
+func New(paths, include, exclude []string) (*Watcher, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: no paths", ErrWatch)
+	}
+	for _, p := range append(slices.Clone(include), exclude...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%w: invalid pattern %q: %w", ErrWatch, p, err)
+		}
+	}
+	xs := make([]string, len(paths))
+	for i, p := range paths {
+		x, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrWatch, p, err)
+		}
+		xs[i] = x
+	}
+	return &Watcher{
+		paths:   xs,
+		include: include,
+		exclude: exclude,
+	}, nil
+}
+
+// Paths returns the absolute paths to be watched.
+func (w Watcher) Paths() []string {
+	return w.paths
+}
+
+func (w Watcher) match(path string) bool {
+	name := filepath.Base(path)
+	for _, p := range w.exclude {
+		if ok, _ := filepath.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(w.include) == 0 {
+		return true
+	}
+	for _, p := range w.include {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Snapshot is the states of the watched files.
+type Snapshot map[string]fileState
+
+// Snapshot returns the current states of the watched files.
+// Missing paths are ignored.
+func (w Watcher) Snapshot() (Snapshot, error) {
+	s := Snapshot{}
+	for _, root := range w.paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || !w.match(path) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			s[path] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrWatch, root, err)
+		}
+	}
+	return s, nil
+}
+
+// Changes returns the paths created, modified or removed since prev, sorted.
+func (s Snapshot) Changes(prev Snapshot) []string {
+	var xs []string
+	for p, x := range s {
+		if y, ok := prev[p]; !ok || !x.modTime.Equal(y.modTime) || x.size != y.size {
+			xs = append(xs, p)
+		}
+	}
+	for p := range prev {
+		if _, ok := s[p]; !ok {
+			xs = append(xs, p)
+		}
+	}
+	slices.Sort(xs)
+	return xs
+}
+
+// Watch calls f with the changed paths until ctx is done.
+//
+// The files are polled every interval,
+// and f is called after no more changes are detected for debounce.
+// The changes made while f runs, including the ones made by f, are reported after f returns;
+// exclude the files written by f not to call f again.
+func (w Watcher) Watch(ctx context.Context, interval, debounce time.Duration, f func(changed []string)) error {
+	prev, err := w.Snapshot()
+	if err != nil {
+		return err
+	}
+	var (
+		ticker  = time.NewTicker(interval)
+		pending []string
+		last    time.Time
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			next, err := w.Snapshot()
+			if err != nil {
+				return err
+			}
+			if xs := next.Changes(prev); len(xs) > 0 {
+				slog.Debug("watch: changed", slog.Any("paths", xs))
+				pending = append(pending, xs...)
+				last = now
+			}
+			prev = next
+			if len(pending) == 0 || now.Sub(last) < debounce {
+				continue
+			}
+			slices.Sort(pending)
+			f(slices.Compact(pending))
+			pending = nil
+			// prev was taken before f, so the changes made while f runs are reported by the next poll
+		}
+	}
+}
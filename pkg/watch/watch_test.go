@@ -0,0 +1,106 @@
+package watch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/berquerant/cmdcomp/pkg/watch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+	write("a.yaml", "a")
+	write("b.yaml", "b")
+	write("c.txt", "c")
+	write("d.bak.yaml", "d")
+
+	w, err := watch.New([]string{dir, filepath.Join(dir, "none")}, []string{"*.yaml"}, []string{"*.bak.*"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	prev, err := w.Snapshot()
+	assert.Nil(t, err)
+	assert.Len(t, prev, 2)
+
+	write("a.yaml", "aa")
+	write("c.txt", "cc")
+	assert.Nil(t, os.Remove(filepath.Join(dir, "b.yaml")))
+	write("e.yaml", "e")
+	next, err := w.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.yaml"),
+		filepath.Join(dir, "b.yaml"),
+		filepath.Join(dir, "e.yaml"),
+	}, next.Changes(prev))
+	assert.Empty(t, next.Changes(next))
+}
+
+func TestNew(t *testing.T) {
+	_, err := watch.New(nil, nil, nil)
+	assert.ErrorIs(t, err, watch.ErrWatch)
+	_, err = watch.New([]string{"."}, []string{"["}, nil)
+	assert.ErrorIs(t, err, watch.ErrWatch)
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a")
+	assert.Nil(t, os.WriteFile(file, []byte("a"), 0o644))
+	w, err := watch.New([]string{dir}, nil, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []string
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(file, []byte("ab"), 0o644)
+	}()
+	err = w.Watch(ctx, 10*time.Millisecond, 30*time.Millisecond, func(changed []string) {
+		got = changed
+		cancel()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{file}, got)
+}
+
+func TestWatchChangedWhileCalling(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a")
+	assert.Nil(t, os.WriteFile(file, []byte("a"), 0o644))
+	w, err := watch.New([]string{dir}, nil, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var calls int
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(file, []byte("ab"), 0o644)
+	}()
+	err = w.Watch(ctx, 10*time.Millisecond, 30*time.Millisecond, func(changed []string) {
+		calls++
+		if calls == 1 {
+			// the file is saved during a slow rerun
+			_ = os.WriteFile(file, []byte("abc"), 0o644)
+			return
+		}
+		assert.Equal(t, []string{file}, changed)
+		cancel()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 2, calls, "the change during f should be reported")
+}